@@ -0,0 +1,94 @@
+// Package audit carries details of profile changes recorded in the audit trail and masks PII of the trail
+package audit
+
+import (
+	"context"
+	"strings"
+
+	"n_users/config"
+	"n_users/entity"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// masked replaces values of masked fields
+const masked = "***"
+
+type actionKey struct{}
+
+// WithAction returns ctx recording changes made with it as action, e.g. an image upload
+// stored through a profile update
+func WithAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, actionKey{}, action)
+}
+
+// Action returns the action of ctx, fallback when none was set
+func Action(ctx context.Context, fallback string) string {
+	if action, ok := ctx.Value(actionKey{}).(string); ok && len(action) > 0 {
+		return action
+	}
+	return fallback
+}
+
+// RequestID returns the id the server assigned to the request of ctx, empty outside requests
+func RequestID(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+// Masker hides values of PII columns in audit entries
+type Masker struct {
+	Fields map[string]bool
+	// Full masks whole values, otherwise the email domain and last 4 mobile digits are kept
+	Full bool
+}
+
+// NewMasker creates new object of Masker from config
+func NewMasker(cfg config.AuditConfig) *Masker {
+	fields := make(map[string]bool, len(cfg.MaskedFields))
+	for _, f := range cfg.MaskedFields {
+		fields[f] = true
+	}
+	return &Masker{Fields: fields, Full: cfg.Mask == "full"}
+}
+
+// Mask returns copies of entries with values of masked fields hidden, a nil Masker masks nothing
+func (m *Masker) Mask(entries []entity.AuditEntry) []entity.AuditEntry {
+	if m == nil {
+		return entries
+	}
+
+	out := make([]entity.AuditEntry, len(entries))
+	for i, e := range entries {
+		changes := make(entity.FieldChanges, len(e.Changes))
+		for field, c := range e.Changes {
+			if m.Fields[field] {
+				c = entity.FieldChange{Before: m.value(field, c.Before), After: m.value(field, c.After)}
+			}
+			changes[field] = c
+		}
+		e.Changes = changes
+		out[i] = e
+	}
+
+	return out
+}
+
+// value masks v of field, missing values stay nil so that setting and clearing remain visible
+func (m *Masker) value(field string, v interface{}) interface{} {
+	s, ok := v.(string)
+	switch {
+	case v == nil:
+		return nil
+	case !ok || m.Full:
+		return masked
+	case field == "email_id":
+		if at := strings.LastIndex(s, "@"); at > 0 {
+			return s[:1] + masked + s[at:]
+		}
+	case field == "mobile":
+		if len(s) > 4 {
+			return masked + s[len(s)-4:]
+		}
+	}
+	return masked
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"n_users/config"
+	"n_users/entity"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestAction(t *testing.T) {
+	ctx := context.Background()
+
+	if a := Action(ctx, entity.AuditUpdate); a != entity.AuditUpdate {
+		t.Errorf("action without one set is %s", a)
+	}
+
+	if a := Action(WithAction(ctx, entity.AuditUploadImage), entity.AuditUpdate); a != entity.AuditUploadImage {
+		t.Errorf("action of image upload is %s", a)
+	}
+
+	if id := RequestID(context.WithValue(ctx, middleware.RequestIDKey, "host/abc-000001")); id != "host/abc-000001" {
+		t.Errorf("request id is %q", id)
+	}
+}
+
+func TestMask(t *testing.T) {
+	entries := []entity.AuditEntry{{
+		Action: entity.AuditUpdate,
+		Changes: entity.FieldChanges{
+			"email_id":  {Before: "nimesh@example.com", After: "n.k@example.org"},
+			"mobile":    {Before: nil, After: "+14155550123"},
+			"latitude":  {Before: 12.97, After: 19.07},
+			"full_name": {Before: "Nimesh", After: "Nimesh K"},
+		},
+	}}
+
+	cases := map[string]struct {
+		mask     string
+		expected entity.FieldChanges
+	}{
+		"partial": {"partial", entity.FieldChanges{
+			"email_id":  {Before: "n***@example.com", After: "n***@example.org"},
+			"mobile":    {Before: nil, After: "***0123"},
+			"latitude":  {Before: "***", After: "***"},
+			"full_name": {Before: "Nimesh", After: "Nimesh K"},
+		}},
+		"full": {"full", entity.FieldChanges{
+			"email_id":  {Before: "***", After: "***"},
+			"mobile":    {Before: nil, After: "***"},
+			"latitude":  {Before: "***", After: "***"},
+			"full_name": {Before: "Nimesh", After: "Nimesh K"},
+		}},
+	}
+
+	for name, c := range cases {
+		m := NewMasker(config.AuditConfig{MaskedFields: []string{"email_id", "mobile", "latitude"}, Mask: c.mask})
+		if masked := m.Mask(entries); !reflect.DeepEqual(masked[0].Changes, c.expected) {
+			t.Errorf("%s mask gave %v but expected %v", name, masked[0].Changes, c.expected)
+		}
+	}
+
+	if entries[0].Changes["email_id"].Before != "nimesh@example.com" {
+		t.Errorf("masking changed the entries it was given")
+	}
+}
@@ -0,0 +1,189 @@
+// Package auth verifies bearer tokens and carries the authenticated principal in request contexts
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"n_users/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string
+	// Tenant is empty when the token has no tenant claim
+	Tenant string
+	Scopes []string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns ctx carrying p
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of ctx, false when the request was not authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator verifies signature and claims of JWT bearer tokens
+type Authenticator struct {
+	Issuer      string
+	Audience    string
+	TenantClaim string
+	ClockSkew   time.Duration
+	// Keys verifies RS256 and ES256 tokens and Secret HS256 tokens, tokens of an algorithm
+	// without configured keys are rejected
+	Keys   *KeySet
+	Secret []byte
+
+	now func() time.Time
+}
+
+// New creates Authenticator of cfg, a JWKS url is fetched before returning
+func New(ctx context.Context, cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		TenantClaim: cfg.TenantClaim,
+		ClockSkew:   cfg.ClockSkew,
+		Secret:      []byte(cfg.HS256Secret),
+	}
+
+	var err error
+	switch {
+	case len(cfg.JWKSFile) > 0:
+		var data []byte
+		if data, err = ioutil.ReadFile(cfg.JWKSFile); err == nil {
+			a.Keys, err = NewStaticKeySet(data)
+		}
+	case len(cfg.JWKSURL) > 0:
+		a.Keys, err = NewRemoteKeySet(ctx, cfg.JWKSURL, nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// methods returns the signing algorithms a has keys for
+func (a *Authenticator) methods() []string {
+	var methods []string
+	if a.Keys != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(a.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// Authenticate verifies token and returns the principal it was issued to
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	methods := a.methods()
+	if len(methods) == 0 {
+		// the parser accepts any algorithm when ValidMethods is empty
+		return Principal{}, errors.New("no token verification keys configured")
+	}
+
+	parser := &jwt.Parser{ValidMethods: methods, SkipClaimsValidation: true}
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		// the algorithm is limited to ValidMethods, keys are picked by it so that
+		// a public key can never be used as HMAC secret
+		if t.Method == jwt.SigningMethodHS256 {
+			return a.Secret, nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return a.Keys.Key(ctx, kid)
+	})
+
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if err := a.verify(claims); err != nil {
+		return Principal{}, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	tenant, _ := claims[a.TenantClaim].(string)
+	return Principal{Subject: sub, Tenant: tenant, Scopes: scopes(claims)}, nil
+}
+
+// verify checks registered claims, exp is required and times are compared allowing ClockSkew
+func (a *Authenticator) verify(claims jwt.MapClaims) error {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+
+	switch {
+	case !claims.VerifyIssuer(a.Issuer, true):
+		return errors.New("token issuer is not " + a.Issuer)
+	case !claims.VerifyAudience(a.Audience, true):
+		return errors.New("token audience is not " + a.Audience)
+	case !claims.VerifyExpiresAt(now().Add(-a.ClockSkew).Unix(), true):
+		return errors.New("token is expired or has no exp claim")
+	case !claims.VerifyNotBefore(now().Add(a.ClockSkew).Unix(), false):
+		return errors.New("token is not valid yet")
+	}
+
+	if sub, _ := claims["sub"].(string); len(sub) == 0 {
+		return errors.New("token has no sub claim")
+	}
+
+	return nil
+}
+
+// scopes returns scopes of the space separated scope claim of OAuth 2.0 or the scp list
+func scopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		list := make([]string, 0, len(scp))
+		for _, s := range scp {
+			list = append(list, fmt.Sprint(s))
+		}
+		return list
+	}
+
+	return nil
+}
+
+// UnknownActor is recorded as author of writes whose context carries no principal
+const UnknownActor = "unknown"
+
+// serviceAccountPrefix tells service accounts apart from token subjects in who columns
+const serviceAccountPrefix = "service:"
+
+// ServiceAccount returns ctx acting as the named service account, for work no request caused
+func ServiceAccount(ctx context.Context, name string) context.Context {
+	return WithPrincipal(ctx, Principal{Subject: serviceAccountPrefix + name})
+}
+
+// Actor returns who writes made with ctx are attributed to, the subject of its principal
+func Actor(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok && len(p.Subject) > 0 {
+		return p.Subject
+	}
+	return UnknownActor
+}
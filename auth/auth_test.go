@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func claims(overrides jwt.MapClaims) jwt.MapClaims {
+	c := jwt.MapClaims{
+		"iss":    "https://issuer",
+		"aud":    []string{"n_users", "billing"},
+		"sub":    "user-1",
+		"tenant": "acme",
+		"scope":  "profiles:read profiles:write",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+		c[k] = v
+	}
+	return c
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, c jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, c)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func jwks(keys ...map[string]string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return data
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(key.N), "e": b64(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X), "y": b64(key.Y)}
+}
+
+func TestAuthenticateHS256(t *testing.T) {
+	a := &Authenticator{Issuer: "https://issuer", Audience: "n_users", TenantClaim: "tenant", ClockSkew: time.Minute, Secret: []byte("dev")}
+
+	p, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(nil)))
+	if err != nil {
+		t.Fatalf("valid token rejected %s", err)
+	}
+
+	expected := Principal{Subject: "user-1", Tenant: "acme", Scopes: []string{"profiles:read", "profiles:write"}}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("principal is %+v but expected %+v", p, expected)
+	}
+
+	// within clock skew
+	if _, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("dev"),
+		claims(jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()}))); err != nil {
+		t.Errorf("token expired within clock skew rejected %s", err)
+	}
+
+	cases := map[string]string{
+		"wrong secret":   sign(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)),
+		"wrong issuer":   sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"iss": "https://evil"})),
+		"wrong audience": sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"aud": "billing"})),
+		"expired":        sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no exp":         sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"exp": nil})),
+		"not yet valid":  sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"no subject":     sign(t, jwt.SigningMethodHS256, "", []byte("dev"), claims(jwt.MapClaims{"sub": nil})),
+		"alg none":       sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+		"HS384":          sign(t, jwt.SigningMethodHS384, "", []byte("dev"), claims(nil)),
+		"garbage":        "not.a.token",
+	}
+
+	for name, token := range cases {
+		if _, err := a.Authenticate(context.Background(), token); err == nil {
+			t.Errorf("%s token was accepted", name)
+		}
+	}
+}
+
+func TestAuthenticateJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	keys, err := NewStaticKeySet(jwks(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey),
+		map[string]string{"kty": "RSA", "kid": "enc-1", "use": "enc"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Authenticator{Issuer: "https://issuer", Audience: "n_users", TenantClaim: "tenant", Keys: keys}
+
+	for name, token := range map[string]string{
+		"RS256": sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(jwt.MapClaims{"scope": nil, "scp": []string{"profiles:read"}})),
+		"ES256": sign(t, jwt.SigningMethodES256, "ec-1", ecKey, claims(jwt.MapClaims{"scope": nil, "scp": []string{"profiles:read"}})),
+	} {
+		p, err := a.Authenticate(context.Background(), token)
+		if err != nil || p.Subject != "user-1" || !reflect.DeepEqual(p.Scopes, []string{"profiles:read"}) {
+			t.Errorf("%s token gave principal %+v, error %v", name, p, err)
+		}
+	}
+
+	// the public key must not be usable as HMAC secret
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	cases := map[string]string{
+		"unknown kid":    sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims(nil)),
+		"key of ec kid":  sign(t, jwt.SigningMethodRS256, "ec-1", rsaKey, claims(nil)),
+		"hs256 with key": sign(t, jwt.SigningMethodHS256, "rsa-1", public, claims(nil)),
+		"hs256 with der": sign(t, jwt.SigningMethodHS256, "rsa-1", der, claims(nil)),
+	}
+
+	for name, token := range cases {
+		if _, err := a.Authenticate(context.Background(), token); err == nil {
+			t.Errorf("%s token was accepted", name)
+		}
+	}
+}
+
+func TestRemoteKeySetRefreshesUnknownKeys(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	published := jwks(ecJWK("old", &oldKey.PublicKey))
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(published)
+	}))
+	defer srv.Close()
+
+	keys, err := NewRemoteKeySet(context.Background(), srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Authenticator{Issuer: "https://issuer", Audience: "n_users", Keys: keys}
+	token := sign(t, jwt.SigningMethodES256, "new", newKey, claims(nil))
+
+	// the key rotated after the last fetch
+	published = jwks(ecJWK("old", &oldKey.PublicKey), ecJWK("new", &newKey.PublicKey))
+	keys.fetched = time.Now().Add(-minRefreshInterval)
+
+	if _, err := a.Authenticate(context.Background(), token); err != nil || fetches != 2 {
+		t.Fatalf("rotated key token gave error %v after %d fetches", err, fetches)
+	}
+
+	// unknown key ids do not refetch again right away
+	if _, err := a.Authenticate(context.Background(), sign(t, jwt.SigningMethodES256, "forged", newKey, claims(nil))); err == nil || fetches != 2 {
+		t.Errorf("forged kid gave error %v after %d fetches", err, fetches)
+	}
+}
+
+func TestParseJWKSRejectsInvalidKeys(t *testing.T) {
+	cases := map[string][]byte{
+		"not json":      []byte("{"),
+		"no keys":       jwks(),
+		"bad modulus":   jwks(map[string]string{"kty": "RSA", "kid": "1", "n": "!!", "e": "AQAB"}),
+		"off curve":     jwks(map[string]string{"kty": "EC", "kid": "1", "crv": "P-256", "x": "AQ", "y": "AQ"}),
+		"unknown curve": jwks(map[string]string{"kty": "EC", "kid": "1", "crv": "P-192", "x": "AQ", "y": "AQ"}),
+	}
+
+	for name, data := range cases {
+		if _, err := ParseJWKS(data); err == nil {
+			t.Errorf("%s jwks was accepted", name)
+		}
+	}
+}
+
+func TestActor(t *testing.T) {
+	ctx := context.Background()
+
+	if a := Actor(ctx); a != UnknownActor {
+		t.Errorf("actor without principal is %s", a)
+	}
+
+	if a := Actor(WithPrincipal(ctx, Principal{Subject: "user-1"})); a != "user-1" {
+		t.Errorf("actor of user is %s", a)
+	}
+
+	if a := Actor(ServiceAccount(ctx, "image-sweeper")); a != "service:image-sweeper" {
+		t.Errorf("actor of service account is %s", a)
+	}
+}
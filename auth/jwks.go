@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits how often an unknown key id refetches the JWKS url, so that
+// tokens with made up key ids can not flood the identity provider
+const minRefreshInterval = time.Minute
+
+// jwk is a JSON web key, only the members of RSA and EC public keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS returns signature verification keys of a JWKS document by key id. Keys of
+// unsupported types or meant for encryption are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range doc.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsa()
+		case "EC":
+			key, err = k.ecdsa()
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwks key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no signature keys")
+	}
+
+	return keys, nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := decodeInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := decodeInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid rsa exponent")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jwk) ecdsa() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.New("unsupported curve " + k.Crv)
+	}
+
+	x, err := decodeInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decodeInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on curve " + k.Crv)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeInt decodes a base64url encoded big endian unsigned integer
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySet holds public keys used to verify token signatures
+type KeySet struct {
+	// fetch returns the JWKS document, it is nil for static key sets
+	fetch func(ctx context.Context) ([]byte, error)
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewStaticKeySet creates a KeySet of the JWKS document in data
+func NewStaticKeySet(data []byte) (*KeySet, error) {
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{keys: keys}, nil
+}
+
+// NewRemoteKeySet creates a KeySet fetching the JWKS document from url, it is fetched once before returning
+func NewRemoteKeySet(ctx context.Context, url string, client *http.Client) (*KeySet, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	ks := &KeySet{fetch: func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks url %s returned status %d", url, res.StatusCode)
+		}
+		return ioutil.ReadAll(res.Body)
+	}}
+
+	if err := ks.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Key returns the key of kid. A token without kid is accepted when the set has a single key.
+// Unknown key ids refetch a remote set, identity providers publish new keys before using them.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	ks.mu.RLock()
+	stale := ks.fetch != nil && time.Since(ks.fetched) >= minRefreshInterval
+	ks.mu.RUnlock()
+
+	if stale {
+		if err := ks.refresh(ctx); err != nil {
+			return nil, err
+		}
+
+		if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if len(kid) == 0 && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// refresh replaces the keys with the fetched JWKS document, keys are kept when fetching fails
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.mu.Lock()
+	ks.fetched = time.Now()
+	ks.mu.Unlock()
+
+	data, err := ks.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching jwks: %w", err)
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+// Scopes granting access to profile operations
+const (
+	// ScopeRead allows reading and searching every profile of the tenant
+	ScopeRead = "profiles:read"
+	// ScopeWrite allows a user to create and change their own profile
+	ScopeWrite = "profiles:write"
+	// ScopeAdmin allows every operation on every profile of the tenant, including purge
+	ScopeAdmin = "profiles:admin"
+)
+
+// HasScope reports whether p was granted scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyScope reports whether p was granted any of scopes
+func (p Principal) HasAnyScope(scopes ...string) bool {
+	for _, s := range scopes {
+		if p.HasScope(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is the access rule of a route. A principal is allowed when it holds any of Scopes, or when
+// it holds any of SelfScopes and the route addresses its own profile, whose id is the principal subject.
+type Policy struct {
+	Scopes     []string
+	SelfScopes []string
+}
+
+// Allow reports whether p may call the route, profileID is empty for routes not addressing a profile
+func (pol Policy) Allow(p Principal, profileID string) bool {
+	if p.HasAnyScope(pol.Scopes...) {
+		return true
+	}
+
+	return len(profileID) > 0 && profileID == p.Subject && p.HasAnyScope(pol.SelfScopes...)
+}
+
+// Profile route policies, users holding ScopeWrite manage only their own profile
+var (
+	ReadProfile   = Policy{Scopes: []string{ScopeRead, ScopeAdmin}, SelfScopes: []string{ScopeWrite}}
+	SearchProfile = Policy{Scopes: []string{ScopeRead, ScopeAdmin}}
+	// CreateProfile lets users create their profile, it is keyed by their subject
+	CreateProfile = Policy{Scopes: []string{ScopeWrite, ScopeAdmin}}
+	WriteProfile  = Policy{Scopes: []string{ScopeAdmin}, SelfScopes: []string{ScopeWrite}}
+	// ReadHistory is kept to admins, entries name the actors of changes
+	ReadHistory = Policy{Scopes: []string{ScopeAdmin}}
+)
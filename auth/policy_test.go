@@ -0,0 +1,24 @@
+package auth
+
+import "testing"
+
+func TestPolicyAllow(t *testing.T) {
+	owner := Principal{Subject: "201", Scopes: []string{ScopeWrite}}
+
+	if !WriteProfile.Allow(owner, "201") || WriteProfile.Allow(owner, "202") {
+		t.Errorf("owner should write only profile 201")
+	}
+
+	// a token without subject must not match routes without a profile id
+	if WriteProfile.Allow(Principal{Scopes: []string{ScopeWrite}}, "") {
+		t.Errorf("empty subject matched empty profile id")
+	}
+
+	if !WriteProfile.Allow(Principal{Subject: "admin", Scopes: []string{ScopeRead, ScopeAdmin}}, "202") {
+		t.Errorf("admin should write any profile")
+	}
+
+	if SearchProfile.Allow(owner, "") {
+		t.Errorf("owner should not search profiles")
+	}
+}
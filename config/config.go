@@ -0,0 +1,489 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"n_users/gateway/objectstore"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Secret is a config value that must never be logged, it is redacted when printed or marshalled
+type Secret string
+
+const redacted = "[redacted]"
+
+func (s Secret) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return redacted
+}
+
+// MarshalJSON redacts the secret, zap logs config through json
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.String())), nil
+}
+
+// MarshalYAML redacts the secret
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// Config represents settings of the service. Every field is read from the config file by its
+// yaml name, from the environment variable named by its env tag and from the command line flag
+// named by its dotted yaml path, e.g. -server.address, in increasing order of precedence.
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	ObjectStore ObjectStoreConfig `yaml:"object_store"`
+	Images      ImagesConfig      `yaml:"images"`
+	Health      HealthConfig      `yaml:"health"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Tenants     TenantsConfig     `yaml:"tenants"`
+	Audit       AuditConfig       `yaml:"audit"`
+	// AdminAPIKey authorizes admin only operations like purge, admin operations are disabled when empty
+	AdminAPIKey Secret `yaml:"admin_api_key" env:"ADMIN_API_KEY"`
+}
+
+// ServerConfig represents settings of the HTTP server
+type ServerConfig struct {
+	Address        string        `yaml:"address" env:"SERVER_ADDRESS"`
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"SERVER_REQUEST_TIMEOUT"`
+	// MaxConcurrentRequests limits requests processed at once, others wait for a free slot
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests" env:"SERVER_MAX_CONCURRENT_REQUESTS"`
+	// DrainDelay is how long readiness fails before the server stops accepting connections,
+	// it gives load balancers time to stop routing new requests
+	DrainDelay time.Duration `yaml:"drain_delay" env:"SERVER_DRAIN_DELAY"`
+	// ShutdownTimeout limits how long in-flight requests are drained
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// DatabaseConfig represents settings of the profile database
+type DatabaseConfig struct {
+	URL          Secret `yaml:"url" env:"POSTGRE_URL_VALUE"`
+	MaxIdleConns int    `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	MaxOpenConns int    `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	LogQueries   bool   `yaml:"log_queries" env:"DB_LOG_QUERIES"`
+}
+
+// ObjectStoreConfig represents settings of the profile image store
+type ObjectStoreConfig struct {
+	// Kind selects the store implementation, s3, local or memory
+	Kind               string `yaml:"kind" env:"OBJECT_STORE"`
+	Bucket             string `yaml:"bucket" env:"OBJECT_STORE_BUCKET"`
+	KeyPrefix          string `yaml:"key_prefix" env:"OBJECT_STORE_KEY_PREFIX"`
+	PublicURLBase      string `yaml:"public_url_base" env:"OBJECT_STORE_PUBLIC_URL"`
+	AWSRegion          string `yaml:"aws_region" env:"AWS_REGION"`
+	AWSAccessKeyID     Secret `yaml:"aws_access_key_id" env:"AWS_SECRET_ID"`
+	AWSSecretAccessKey Secret `yaml:"aws_secret_access_key" env:"AWS_SECRET"`
+}
+
+// StoreConfig returns settings shared by all object store implementations
+func (c ObjectStoreConfig) StoreConfig() objectstore.Config {
+	return objectstore.Config{Bucket: c.Bucket, KeyPrefix: c.KeyPrefix, PublicURLBase: c.PublicURLBase}
+}
+
+// ImagesConfig represents settings of profile image upload and cleanup
+type ImagesConfig struct {
+	MaxUploadSize int64         `yaml:"max_upload_size" env:"IMAGE_MAX_UPLOAD_SIZE"`
+	SweepInterval time.Duration `yaml:"sweep_interval" env:"IMAGE_SWEEP_INTERVAL"`
+	// SweepGracePeriod protects objects of uploads that are not yet saved on the profile, and
+	// images of soft deleted profiles until they were deleted that long ago
+	SweepGracePeriod time.Duration `yaml:"sweep_grace_period" env:"IMAGE_SWEEP_GRACE_PERIOD"`
+}
+
+// HealthConfig represents settings of readiness checks
+type HealthConfig struct {
+	// CheckTimeout limits how long a dependency check may take before it is reported down
+	CheckTimeout time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// CacheTTL is how long a check report is served to probes before checks run again
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"HEALTH_CACHE_TTL"`
+}
+
+// MetricsConfig represents settings of the metrics endpoint
+type MetricsConfig struct {
+	// Address of the listener serving /metrics, kept apart from server.address so that it is not public
+	Address string `yaml:"address" env:"METRICS_ADDRESS"`
+	// MaxTenants caps distinct tenant label values, later tenants are reported as "other"
+	MaxTenants int `yaml:"max_tenants" env:"METRICS_MAX_TENANTS"`
+}
+
+// TracingConfig represents settings of distributed tracing
+type TracingConfig struct {
+	// Exporter selects where spans are sent, otlp, stdout or none
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// OTLPEndpoint is the url of the OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	ServiceName  string `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	// SampleRatio is the share of new traces recorded, sampling decisions of callers are respected
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// AuthConfig represents settings of bearer token authentication. RS256 and ES256 tokens are verified
+// with keys of the JWKS file or url, HS256 tokens with the shared secret.
+type AuthConfig struct {
+	// Issuer and Audience must match iss and aud claims of every token
+	Issuer   string `yaml:"issuer" env:"AUTH_ISSUER"`
+	Audience string `yaml:"audience" env:"AUTH_AUDIENCE"`
+	JWKSFile string `yaml:"jwks_file" env:"AUTH_JWKS_FILE"`
+	// JWKSURL is fetched at startup and again when a token is signed by an unknown key
+	JWKSURL string `yaml:"jwks_url" env:"AUTH_JWKS_URL"`
+	// HS256Secret verifies HS256 tokens, it is meant for local development only and can not be
+	// combined with a JWKS, so that production never accepts tokens signed with a shared secret
+	HS256Secret Secret `yaml:"hs256_secret" env:"AUTH_HS256_SECRET"`
+	// TenantClaim names the claim holding the tenant of the caller
+	TenantClaim string `yaml:"tenant_claim" env:"AUTH_TENANT_CLAIM"`
+	// ClockSkew is tolerated when checking exp and nbf claims
+	ClockSkew time.Duration `yaml:"clock_skew" env:"AUTH_CLOCK_SKEW"`
+}
+
+// TenantsConfig represents settings of tenant resolution
+type TenantsConfig struct {
+	// Source selects where the tenant of a request is read from, claim, subdomain or header.
+	// The tenant claim of the token, when present, must match a subdomain or header tenant.
+	Source string `yaml:"source" env:"TENANT_SOURCE"`
+	Header string `yaml:"header" env:"TENANT_HEADER"`
+	// BaseDomain is the domain tenant subdomains are served under, e.g. users.example.com
+	BaseDomain string `yaml:"base_domain" env:"TENANT_BASE_DOMAIN"`
+	// CacheTTL is how long registry entries are cached, a suspension takes effect after it
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"TENANT_CACHE_TTL"`
+}
+
+// AuditedColumns lists the profile columns whose values audit entries record, the columns
+// audit.masked_fields may name
+var AuditedColumns = []string{
+	"tenant_id", "profile_id", "full_name", "gender", "email_id", "mobile", "birth_date", "city_id", "country_id",
+	"address", "latitude", "longitude", "profile_image_url", "profile_image_renditions", "active", "deleted_by", "deleted_at",
+}
+
+// AuditConfig represents settings of the profile audit trail
+type AuditConfig struct {
+	// MaskedFields lists profile columns masked in the history, comma separated in env and flags
+	MaskedFields []string `yaml:"masked_fields" env:"AUDIT_MASKED_FIELDS"`
+	// Mask is partial, keeping the email domain and last mobile digits, or full
+	Mask string `yaml:"mask" env:"AUDIT_MASK"`
+}
+
+// Default returns config used for settings that are not configured
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Address:               ":8085",
+			RequestTimeout:        3 * time.Second,
+			MaxConcurrentRequests: 1000,
+			DrainDelay:            5 * time.Second,
+			ShutdownTimeout:       15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxIdleConns: 5,
+			MaxOpenConns: 100,
+			LogQueries:   true,
+		},
+		ObjectStore: ObjectStoreConfig{
+			Kind:          "s3",
+			Bucket:        "images.repo.bucket1",
+			KeyPrefix:     "images/",
+			PublicURLBase: "https://s3.ap-south-1.amazonaws.com/images.repo.bucket1/",
+		},
+		Images: ImagesConfig{
+			MaxUploadSize:    2 * 1024000,
+			SweepInterval:    time.Hour,
+			SweepGracePeriod: time.Hour,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+			CacheTTL:     5 * time.Second,
+		},
+		Metrics: MetricsConfig{
+			Address:    ":9102",
+			MaxTenants: 50,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "n_users",
+			SampleRatio: 1,
+		},
+		Auth: AuthConfig{
+			Audience:    "n_users",
+			TenantClaim: "tenant",
+			ClockSkew:   time.Minute,
+		},
+		Tenants: TenantsConfig{
+			Source:   "claim",
+			Header:   "ntenant",
+			CacheTTL: 30 * time.Second,
+		},
+		Audit: AuditConfig{
+			MaskedFields: []string{"full_name", "email_id", "mobile", "birth_date", "address", "latitude", "longitude"},
+			Mask:         "partial",
+		},
+	}
+}
+
+// Load reads config from the file named by -config flag or CONFIG_FILE, the environment and
+// command line flags in args, and validates it. It returns args left after the flags.
+func Load(args []string) (Config, []string, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	cfg := Default()
+	fields := leafFields(reflect.ValueOf(&cfg).Elem(), "")
+
+	fs := flag.NewFlagSet("n_users", flag.ContinueOnError)
+	file, _ := lookupEnv("CONFIG_FILE")
+	fs.StringVar(&file, "config", file, "yaml or json config file")
+
+	// flags are applied last, so they are only recorded while parsing
+	var flagged []flagValue
+	for _, f := range fields {
+		fs.Var(&recorder{field: f, values: &flagged}, f.Path, "overrides "+f.Path+envHelp(f))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return cfg, nil, err
+		}
+
+		// yaml is a superset of json, so both formats are accepted
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return cfg, nil, fmt.Errorf("config file %s: %w", file, err)
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := lookupEnv(f.Env); len(f.Env) > 0 && ok && len(value) > 0 {
+			if err := set(f.Value, value); err != nil {
+				return cfg, nil, fmt.Errorf("environment variable %s: %w", f.Env, err)
+			}
+		}
+	}
+
+	for _, v := range flagged {
+		if err := set(v.Field.Value, v.Raw); err != nil {
+			return cfg, nil, fmt.Errorf("flag -%s: %w", v.Field.Path, err)
+		}
+	}
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// Validate returns error listing every invalid setting
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(len(c.Server.Address) > 0, "server.address is required")
+	check(c.Server.RequestTimeout > 0, "server.request_timeout must be positive")
+	check(c.Server.MaxConcurrentRequests > 0, "server.max_concurrent_requests must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(len(c.Database.URL) > 0, "database.url is required")
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns must be positive")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must be between 0 and database.max_open_conns")
+	check(c.Images.MaxUploadSize > 0, "images.max_upload_size must be positive")
+	check(c.Images.SweepInterval > 0, "images.sweep_interval must be positive")
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+	check(c.Health.CacheTTL >= 0, "health.cache_ttl must not be negative")
+	check(len(c.Metrics.Address) > 0, "metrics.address is required")
+	check(c.Metrics.Address != c.Server.Address, "metrics.address must differ from server.address")
+	check(c.Metrics.MaxTenants >= 0, "metrics.max_tenants must not be negative")
+	check(len(c.Tracing.ServiceName) > 0, "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(len(c.Auth.Issuer) > 0, "auth.issuer is required")
+	check(len(c.Auth.Audience) > 0, "auth.audience is required")
+	check(len(c.Auth.JWKSFile) > 0 || len(c.Auth.JWKSURL) > 0 || len(c.Auth.HS256Secret) > 0,
+		"auth.jwks_file, auth.jwks_url or auth.hs256_secret is required")
+	check(len(c.Auth.JWKSFile) == 0 || len(c.Auth.JWKSURL) == 0, "auth.jwks_file and auth.jwks_url are exclusive")
+	check(len(c.Auth.HS256Secret) == 0 || len(c.Auth.JWKSFile)+len(c.Auth.JWKSURL) == 0,
+		"auth.hs256_secret is for local development and exclusive with auth.jwks_file and auth.jwks_url")
+	check(len(c.Auth.TenantClaim) > 0, "auth.tenant_claim is required")
+	check(c.Auth.ClockSkew >= 0, "auth.clock_skew must not be negative")
+	check(c.Images.SweepGracePeriod >= 0, "images.sweep_grace_period must not be negative")
+
+	switch c.ObjectStore.Kind {
+	case "memory":
+	case "local", "s3":
+		check(len(c.ObjectStore.Bucket) > 0, "object_store.bucket is required for "+c.ObjectStore.Kind+" store")
+	default:
+		problems = append(problems, "object_store.kind must be s3, local or memory")
+	}
+
+	switch c.Tenants.Source {
+	case "claim":
+	case "header":
+		check(len(c.Tenants.Header) > 0, "tenants.header is required for header source")
+	case "subdomain":
+		check(len(c.Tenants.BaseDomain) > 0, "tenants.base_domain is required for subdomain source")
+	default:
+		problems = append(problems, "tenants.source must be claim, subdomain or header")
+	}
+	check(c.Tenants.CacheTTL >= 0, "tenants.cache_ttl must not be negative")
+
+	audited := make(map[string]bool, len(AuditedColumns))
+	for _, column := range AuditedColumns {
+		audited[column] = true
+	}
+	for _, field := range c.Audit.MaskedFields {
+		check(audited[field], fmt.Sprintf("audit.masked_fields has %q which is not an audited profile column", field))
+	}
+	check(c.Audit.Mask == "partial" || c.Audit.Mask == "full", "audit.mask must be partial or full")
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		u, err := url.Parse(c.Tracing.OTLPEndpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0,
+			"tracing.otlp_endpoint must be an http or https url for otlp exporter")
+	default:
+		problems = append(problems, "tracing.exporter must be otlp, stdout or none")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return errors.New("invalid config: " + strings.Join(problems, ", "))
+}
+
+// field is a configurable setting
+type field struct {
+	Path  string
+	Env   string
+	Value reflect.Value
+}
+
+// leafFields returns settings of v named by their dotted yaml path
+func leafFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if len(name) == 0 || name == "-" {
+			continue
+		}
+
+		path := prefix + name
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			fields = append(fields, leafFields(v.Field(i), path+".")...)
+			continue
+		}
+
+		fields = append(fields, field{Path: path, Env: t.Field(i).Tag.Get("env"), Value: v.Field(i)})
+	}
+
+	return fields
+}
+
+func envHelp(f field) string {
+	if len(f.Env) == 0 {
+		return ""
+	}
+	return ", env " + f.Env
+}
+
+// set parses s into setting v
+func set(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported setting type %s", v.Type())
+		}
+
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+type flagValue struct {
+	Field field
+	Raw   string
+}
+
+// recorder is a flag.Value that records raw flag values in the order they were given
+type recorder struct {
+	field  field
+	values *[]flagValue
+}
+
+func (r *recorder) String() string {
+	if r == nil || !r.field.Value.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(r.field.Value.Interface())
+}
+
+func (r *recorder) Set(s string) error {
+	if err := set(reflect.New(r.field.Value.Type()).Elem(), s); err != nil {
+		return err
+	}
+
+	*r.values = append(*r.values, flagValue{Field: r.field, Raw: s})
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be enabled by the bare flag, e.g. -database.log_queries
+func (r *recorder) IsBoolFlag() bool {
+	return r.field.Value.Kind() == reflect.Bool
+}
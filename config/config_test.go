@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+server:
+  address: ":9000"
+  request_timeout: 5s
+database:
+  url: postgres://file
+  max_open_conns: 20
+object_store:
+  kind: memory
+`
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, args, err := load(
+		[]string{"-config", file, "-server.address", ":9100", "-database.log_queries=false", "migrate", "up"},
+		env(map[string]string{"POSTGRE_URL_VALUE": "postgres://env", "SERVER_ADDRESS": ":9050", "DB_MAX_OPEN_CONNS": "",
+			"AUTH_ISSUER": "https://issuer", "AUTH_HS256_SECRET": "dev", "AUDIT_MASKED_FIELDS": "email_id, mobile,"}),
+	)
+	if err != nil {
+		t.Fatalf("load config error %s", err)
+	}
+
+	if cfg.Server.Address != ":9100" {
+		t.Errorf("address is %s but flag should win", cfg.Server.Address)
+	}
+
+	if cfg.Database.URL != "postgres://env" {
+		t.Errorf("database url is %s but environment should win over file", string(cfg.Database.URL))
+	}
+
+	if cfg.Server.RequestTimeout != 5*time.Second || cfg.Database.MaxOpenConns != 20 || cfg.ObjectStore.Kind != "memory" {
+		t.Errorf("file settings were not applied %+v", cfg)
+	}
+
+	if cfg.Server.MaxConcurrentRequests != 1000 || cfg.Database.LogQueries {
+		t.Errorf("defaults and bool flag were not applied %+v", cfg)
+	}
+
+	if strings.Join(cfg.Audit.MaskedFields, " ") != "email_id mobile" {
+		t.Errorf("masked fields are %v but expected the environment list", cfg.Audit.MaskedFields)
+	}
+
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args left after flags are %v", args)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(file, []byte(`{"server": {"adress": ":1"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]string{
+		"unknown file key":  {"-config", file},
+		"bad duration":      {"-server.request_timeout", "soon"},
+		"missing url":       {"-database.url", ""},
+		"bad store":         {"-object_store.kind", "ftp"},
+		"missing keys":      {"-auth.hs256_secret", ""},
+		"two jwks sources":  {"-auth.jwks_file", "jwks.json", "-auth.jwks_url", "https://issuer/jwks.json"},
+		"secret with jwks":  {"-auth.jwks_url", "https://issuer/jwks.json"},
+		"bad tenant source": {"-tenants.source", "query"},
+		"no base domain":    {"-tenants.source", "subdomain"},
+		"bad audit mask":    {"-audit.mask", "half"},
+		"unknown masked":    {"-audit.masked_fields", "email_id,emial"},
+	}
+
+	for name, args := range cases {
+		values := map[string]string{"POSTGRE_URL_VALUE": "postgres://env", "AUTH_ISSUER": "https://issuer", "AUTH_HS256_SECRET": "dev"}
+		if _, _, err := load(args, env(values)); err == nil {
+			t.Errorf("%s loaded without error", name)
+		}
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	values := map[string]string{"POSTGRE_URL_VALUE": "postgres://env", "AUTH_ISSUER": "https://issuer", "AUTH_HS256_SECRET": "dev"}
+	cfg, _, err := load([]string{"-config", "../config.example.yaml"}, env(values))
+	if err != nil {
+		t.Fatalf("example config error %s", err)
+	}
+
+	expected := Default()
+	expected.Database.URL = "postgres://env"
+	expected.ObjectStore.AWSRegion = "ap-south-1"
+	expected.Auth.Issuer = "https://issuer"
+	expected.Auth.HS256Secret = "dev"
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("example config %+v does not match defaults", cfg)
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://user:pa55@db/users"
+	cfg.AdminAPIKey = "admin-s3cret"
+	cfg.Auth.HS256Secret = "hs-s3cret"
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"pa55", "admin-s3cret", "hs-s3cret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("marshalled config %s contains secret %s", data, secret)
+		}
+	}
+
+	if !strings.Contains(string(data), redacted) {
+		t.Errorf("marshalled config %s does not mark redacted secrets", data)
+	}
+}
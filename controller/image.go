@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"n_users/audit"
+	"n_users/auth"
+	"n_users/entity"
+	"n_users/gateway/objectstore"
+	"n_users/imaging"
+	"n_users/repo"
+	"n_users/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// imageKeySeparator separates image key from rendition size in object keys, e.g. <key>_256.jpg
+const imageKeySeparator = "_"
+
+// ErrNoProfileImage is returned when the image of a profile without one is deleted
+var ErrNoProfileImage = entity.NewDomainError(entity.KindNotFound, "profile_image_not_found", "profile has no image")
+
+// UploadProfileImage stores renditions of the image and returns them with the new profile version.
+// When version is not zero the image is saved only if the profile still has that version.
+func (s *service) UploadProfileImage(ctx context.Context, profileID string, tenantID string, image []byte, version int64) (entity.ImageRenditions, int64, error) {
+	tracing.Logger(ctx).Info("receive upload profile image request",
+		zap.String("profile_id", profileID),
+		zap.String("tenant_id", tenantID))
+
+	images, err := imaging.Process(image, imaging.DefaultOptions)
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing upload profile image request", zap.Error(err))
+		return nil, 0, entity.WrapError(entity.KindUnsupportedMedia, "invalid_image", "", err)
+	}
+
+	profile, err := s.Repo.Get(ctx, profileID, tenantID)
+	if err == nil && version != 0 && profile.Version != version {
+		err = repo.ErrVersionMismatch
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing upload profile image request", zap.Error(err))
+		return nil, 0, err
+	}
+
+	key := uuid.New().String()
+	renditions := entity.ImageRenditions{}
+	profileImageURL := ""
+
+	for _, image := range images {
+		objectKey := key + imageKeySeparator + strconv.Itoa(image.Size) + image.Ext
+		err = s.Store.Put(ctx, objectKey, bytes.NewReader(image.Data), int64(len(image.Data)), image.ContentType)
+		if err != nil {
+			tracing.Logger(ctx).Error("error processing upload profile image request", zap.Error(err))
+			s.deleteImage(ctx, key)
+			return nil, 0, entity.WrapError(entity.KindUnavailable, "object_store_unavailable", "unable to store profile image", err)
+		}
+
+		// largest rendition is served as the main profile image
+		profileImageURL = s.Store.URL(objectKey)
+		renditions[strconv.Itoa(image.Size)] = profileImageURL
+	}
+
+	filter := map[string]interface{}{"profile_id": profileID, "tenant_id": tenantID}
+	if version != 0 {
+		filter["version"] = version
+	}
+
+	fieldsToUpdate := map[string]interface{}{
+		"profile_image_url":        profileImageURL,
+		"profile_image_renditions": renditions,
+		"profile_image_key":        key,
+	}
+
+	newVersion, err := s.Repo.Update(audit.WithAction(ctx, entity.AuditUploadImage), filter, fieldsToUpdate)
+	if err == nil && newVersion == 0 {
+		err = repo.ErrNotFound
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing upload profile image request", zap.Error(err))
+		s.deleteImage(ctx, key)
+		return nil, 0, err
+	}
+
+	// previous image is replaced, its objects are no longer referenced
+	s.deleteImage(ctx, profile.ProfileImageKey)
+
+	return renditions, newVersion, nil
+}
+
+// DeleteProfileImage removes the image of the profile and returns the new profile version. When
+// version is not zero the image is removed only if the profile still has that version.
+func (s *service) DeleteProfileImage(ctx context.Context, profileID string, tenantID string, version int64) (int64, error) {
+	tracing.Logger(ctx).Info("receive delete profile image request",
+		zap.String("profile_id", profileID),
+		zap.String("tenant_id", tenantID))
+
+	profile, err := s.Repo.Get(ctx, profileID, tenantID)
+	switch {
+	case err != nil:
+	case version != 0 && profile.Version != version:
+		err = repo.ErrVersionMismatch
+	case len(profile.ProfileImageKey) == 0:
+		err = ErrNoProfileImage
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing delete profile image request", zap.Error(err))
+		return 0, err
+	}
+
+	filter := map[string]interface{}{"profile_id": profileID, "tenant_id": tenantID}
+	if version != 0 {
+		filter["version"] = version
+	}
+
+	fieldsToUpdate := map[string]interface{}{
+		"profile_image_url":        "",
+		"profile_image_renditions": nil,
+		"profile_image_key":        "",
+	}
+
+	newVersion, err := s.Repo.Update(audit.WithAction(ctx, entity.AuditDeleteImage), filter, fieldsToUpdate)
+	if err == nil && newVersion == 0 {
+		err = repo.ErrNotFound
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing delete profile image request", zap.Error(err))
+		return 0, err
+	}
+
+	s.deleteImage(ctx, profile.ProfileImageKey)
+	return newVersion, nil
+}
+
+// deleteImage removes every rendition stored under the image key. Failures are only
+// logged, objects left behind are removed later by the ImageSweeper.
+func (s *service) deleteImage(ctx context.Context, key string) {
+	if len(key) == 0 {
+		return
+	}
+
+	objects, err := s.Store.List(ctx, key+imageKeySeparator)
+	if err != nil {
+		tracing.Logger(ctx).Warn("error listing profile image objects", zap.String("key", key), zap.Error(err))
+		return
+	}
+
+	for _, o := range objects {
+		if err := s.Store.Delete(ctx, o.Key); err != nil {
+			tracing.Logger(ctx).Warn("error deleting profile image object", zap.String("key", o.Key), zap.Error(err))
+		}
+	}
+}
+
+// dropSweptImage clears the image of a restored profile when the ImageSweeper already removed its objects
+func (s *service) dropSweptImage(ctx context.Context, profileID string, tenantID string) error {
+	profile, err := s.Repo.Get(ctx, profileID, tenantID)
+	if err != nil || len(profile.ProfileImageKey) == 0 {
+		return err
+	}
+
+	objects, err := s.Store.List(ctx, profile.ProfileImageKey+imageKeySeparator)
+	if err != nil || len(objects) > 0 {
+		return err
+	}
+
+	filter := map[string]interface{}{"profile_id": profileID, "tenant_id": tenantID}
+	fieldsToUpdate := map[string]interface{}{
+		"profile_image_url":        "",
+		"profile_image_renditions": nil,
+		"profile_image_key":        "",
+	}
+
+	_, err = s.Repo.Update(audit.WithAction(ctx, entity.AuditDeleteImage), filter, fieldsToUpdate)
+	return err
+}
+
+// imageKey returns image key of an object key, empty when object was not written by UploadProfileImage
+func imageKey(objectKey string) string {
+	i := strings.LastIndex(objectKey, imageKeySeparator)
+	if i <= 0 {
+		return ""
+	}
+	return objectKey[:i]
+}
+
+// ImageSweeper periodically removes image objects that no profile references
+type ImageSweeper struct {
+	Repo  repo.ProfileRepo
+	Store objectstore.ObjectStore
+	// GracePeriod protects objects of uploads that are not yet saved on the profile, and images
+	// of profiles soft deleted more recently, so that they can be restored with their image
+	GracePeriod time.Duration
+	// BatchSize is the number of image keys checked against the database at once
+	BatchSize int
+}
+
+// NewImageSweeper creates new object of ImageSweeper
+func NewImageSweeper(repo repo.ProfileRepo, store objectstore.ObjectStore, gracePeriod time.Duration) *ImageSweeper {
+	return &ImageSweeper{Repo: repo, Store: store, GracePeriod: gracePeriod, BatchSize: 500}
+}
+
+// Sweep deletes orphaned image objects once and returns how many objects were deleted
+func (sw *ImageSweeper) Sweep(ctx context.Context) (deleted int, err error) {
+	ctx, span := tracing.Start(ctx, "ImageSweeper.Sweep")
+	defer func() {
+		span.SetAttributes(attribute.Int("images.deleted", deleted))
+		tracing.End(span, err)
+	}()
+
+	objects, err := sw.Store.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-sw.GracePeriod)
+	candidates := map[string][]string{}
+	keys := []string{}
+
+	for _, o := range objects {
+		key := imageKey(o.Key)
+		if len(key) == 0 || o.LastModified.After(cutoff) {
+			continue
+		}
+
+		if _, ok := candidates[key]; !ok {
+			keys = append(keys, key)
+		}
+		candidates[key] = append(candidates[key], o.Key)
+	}
+
+	for start := 0; start < len(keys); start += sw.BatchSize {
+		end := start + sw.BatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		inUse, err := sw.Repo.ImageKeysInUse(ctx, keys[start:end], cutoff)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, key := range keys[start:end] {
+			if inUse[key] {
+				continue
+			}
+
+			for _, objectKey := range candidates[key] {
+				if err := sw.Store.Delete(ctx, objectKey); err != nil {
+					tracing.Logger(ctx).Warn("error deleting orphaned image object", zap.String("key", objectKey), zap.Error(err))
+					continue
+				}
+				deleted++
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// Start runs Sweep every interval in background until returned stop function is called. Stop
+// cancels a running sweep and returns once it has ended, so its resources can be closed after.
+func (sw *ImageSweeper) Start(interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(auth.ServiceAccount(context.Background(), "image-sweeper"))
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deleted, err := sw.Sweep(ctx)
+				if err != nil {
+					zap.L().Error("error sweeping orphaned images", zap.Error(err))
+				} else {
+					zap.L().Info("swept orphaned images", zap.Int("deleted", deleted))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-stopped
+	}
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"n_users/audit"
+	"n_users/entity"
+	"n_users/gateway/memstore"
+	"n_users/gateway/objectstore"
+	"n_users/mocks"
+	"n_users/repo"
+
+	"github.com/golang/mock/gomock"
+)
+
+func testPNG() []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 100, 100)))
+	return buf.Bytes()
+}
+
+func TestUploadProfileImageReplacesOldImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "old_64.png", strings.NewReader("image"), 5, "image/png")
+	store.Put(context.Background(), "old_256.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{ProfileImageKey: "old"}, nil)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, filters map[string]interface{}, fields map[string]interface{}) (int64, error) {
+			if action := audit.Action(ctx, entity.AuditUpdate); action != entity.AuditUploadImage {
+				t.Errorf("image upload is audited as %s", action)
+			}
+			return 2, nil
+		})
+
+	renditions, _, err := New(mockProfileRepo, store).UploadProfileImage(context.Background(), "101", "mars", testPNG(), 0)
+	if err != nil {
+		t.Fatalf("upload profile image error %s", err)
+	}
+
+	objects := store.Objects()
+	if len(objects) != len(renditions) {
+		t.Errorf("store has %d objects but expected %d renditions", len(objects), len(renditions))
+	}
+
+	for key := range objects {
+		if strings.HasPrefix(key, "old_") {
+			t.Errorf("old image object %s was not deleted", key)
+		}
+	}
+}
+
+func TestUploadProfileImageRejectsStaleVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{Version: 3}, nil)
+
+	_, _, err := New(mockProfileRepo, store).UploadProfileImage(context.Background(), "101", "mars", testPNG(), 2)
+	if !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Errorf("upload with stale version returned %v but expected version mismatch", err)
+	}
+
+	if objects := store.Objects(); len(objects) != 0 {
+		t.Errorf("upload with stale version stored objects %v", objects)
+	}
+}
+
+func TestUploadProfileImageCleansUpWhenProfileIsMissing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{}, nil)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0), nil)
+
+	if _, _, err := New(mockProfileRepo, store).UploadProfileImage(context.Background(), "101", "mars", testPNG(), 0); err == nil {
+		t.Errorf("upload for missing profile succeeded")
+	}
+
+	if objects := store.Objects(); len(objects) != 0 {
+		t.Errorf("upload for missing profile left objects %v", objects)
+	}
+}
+
+func TestDeleteProfileImageChecksVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "old_64.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{ProfileImageKey: "old", Version: 3}, nil).Times(2)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, filters map[string]interface{}, fields map[string]interface{}) (int64, error) {
+			if filters["version"] != int64(3) {
+				t.Errorf("image is deleted with filters %v but expected the If-Match version", filters)
+			}
+			return 4, nil
+		})
+
+	s := New(mockProfileRepo, store)
+	if _, err := s.DeleteProfileImage(context.Background(), "101", "mars", 2); !errors.Is(err, repo.ErrVersionMismatch) {
+		t.Errorf("delete with stale version returned %v but expected version mismatch", err)
+	}
+
+	if version, err := s.DeleteProfileImage(context.Background(), "101", "mars", 3); err != nil || version != 4 {
+		t.Errorf("delete profile image returned %d, %v but expected version 4", version, err)
+	}
+
+	if objects := store.Objects(); len(objects) != 0 {
+		t.Errorf("delete profile image left objects %v", objects)
+	}
+}
+
+func TestDeleteMissingProfileImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{Version: 3}, nil)
+
+	_, err := New(mockProfileRepo, memstore.New(objectstore.Config{})).DeleteProfileImage(context.Background(), "101", "mars", 0)
+	if e := entity.AsDomainError(err); !errors.Is(err, ErrNoProfileImage) || e.Kind != entity.KindNotFound {
+		t.Errorf("delete of missing image returned %v but expected not found", err)
+	}
+}
+
+func TestDeleteProfileKeepsImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "img_64.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Delete(gomock.Any(), "101", "mars", int64(0)).Return(true, nil)
+
+	if _, err := New(mockProfileRepo, store).Delete(context.Background(), "101", "mars", 0); err != nil {
+		t.Fatalf("delete profile error %s", err)
+	}
+
+	if objects := store.Objects(); len(objects) != 1 {
+		t.Errorf("soft delete removed image objects, left %v", objects)
+	}
+}
+
+func TestRestoreProfileDropsSweptImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "kept_64.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Restore(gomock.Any(), "101", "mars").Return(true, nil).Times(2)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{ProfileImageKey: "kept"}, nil)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "101", "mars").Return(entity.Profile{ProfileImageKey: "swept"}, nil)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), map[string]interface{}{
+		"profile_image_url":        "",
+		"profile_image_renditions": nil,
+		"profile_image_key":        "",
+	}).DoAndReturn(func(ctx context.Context, _, _ map[string]interface{}) (int64, error) {
+		if a := audit.Action(ctx, entity.AuditUpdate); a != entity.AuditDeleteImage {
+			t.Errorf("swept image is cleared with action %s", a)
+		}
+		return 3, nil
+	})
+
+	s := New(mockProfileRepo, store)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Restore(context.Background(), "101", "mars"); err != nil {
+			t.Fatalf("restore profile error %s", err)
+		}
+	}
+}
+
+func TestPurgeProfileDeletesImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "img_64.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Purge(gomock.Any(), "101", "mars").Return(entity.Profile{ProfileImageKey: "img"}, nil)
+
+	if _, err := New(mockProfileRepo, store).Purge(context.Background(), "101", "mars"); err != nil {
+		t.Fatalf("purge profile error %s", err)
+	}
+
+	if objects := store.Objects(); len(objects) != 0 {
+		t.Errorf("purge profile left image objects %v", objects)
+	}
+}
+
+func TestImageSweeper(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{KeyPrefix: "images/"})
+	for _, key := range []string{"used_64.png", "orphan_64.png", "orphan_256.png", "fresh_64.png", "unknown.png"} {
+		store.Put(context.Background(), key, strings.NewReader("image"), 5, "image/png")
+		if key != "fresh_64.png" {
+			store.SetLastModified(key, time.Now().Add(-2*time.Hour))
+		}
+	}
+
+	mockProfileRepo.EXPECT().ImageKeysInUse(gomock.Any(), []string{"orphan", "used"}, gomock.Any()).Return(map[string]bool{"used": true}, nil)
+
+	deleted, err := NewImageSweeper(mockProfileRepo, store, time.Hour).Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep error %s", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("sweep deleted %d objects but expected 2", deleted)
+	}
+
+	objects := store.Objects()
+	for _, key := range []string{"images/used_64.png", "images/fresh_64.png", "images/unknown.png"} {
+		if _, ok := objects[key]; !ok {
+			t.Errorf("sweep deleted %s", key)
+		}
+	}
+}
+
+func TestStopCancelsRunningSweep(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "orphan_64.png", strings.NewReader("image"), 5, "image/png")
+	store.SetLastModified("orphan_64.png", time.Now().Add(-2*time.Hour))
+
+	running := make(chan struct{})
+	ended := false
+	mockProfileRepo.EXPECT().ImageKeysInUse(gomock.Any(), []string{"orphan"}, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, keys []string, deletedBefore time.Time) (map[string]bool, error) {
+			close(running)
+			<-ctx.Done()
+			ended = true
+			return nil, ctx.Err()
+		})
+
+	stop := NewImageSweeper(mockProfileRepo, store, time.Hour).Start(time.Millisecond)
+	<-running
+	stop()
+
+	if !ended {
+		t.Errorf("stop returned while a sweep was still running")
+	}
+	if len(store.Objects()) != 1 {
+		t.Errorf("cancelled sweep deleted objects")
+	}
+}
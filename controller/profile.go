@@ -1,97 +1,185 @@
 package controller
 
 import (
+	"context"
+
 	"n_users/entity"
+	"n_users/gateway/objectstore"
 	"n_users/repo"
+	"n_users/tracing"
+	"n_users/validation"
 
 	"go.uber.org/zap"
 )
 
 // ProfileService represents interface to manage profile
 type ProfileService interface {
-	Create(profile entity.Profile) (string, error)
-	Delete(profileID string, tenantID string) (bool, error)
-	Search(query string, limit int, offset int, sortBy string, tenantID string) ([]entity.Profile, error)
-	Update(filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (bool, error)
-	UploadProfileImage(profileID string, image []byte) (bool, error)
+	Create(ctx context.Context, profile entity.Profile) (string, error)
+	Delete(ctx context.Context, profileID string, tenantID string, version int64) (bool, error)
+	Restore(ctx context.Context, profileID string, tenantID string) (bool, error)
+	Purge(ctx context.Context, profileID string, tenantID string) (bool, error)
+	Get(ctx context.Context, profileID string, tenantID string) (entity.Profile, error)
+	Search(ctx context.Context, request entity.SearchProfileRequest, tenantID string) (entity.SearchProfileResponse, error)
+	Update(ctx context.Context, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (int64, error)
+	UploadProfileImage(ctx context.Context, profileID string, tenantID string, image []byte, version int64) (entity.ImageRenditions, int64, error)
+	DeleteProfileImage(ctx context.Context, profileID string, tenantID string, version int64) (int64, error)
+	History(ctx context.Context, profileID string, tenantID string, limit int, cursor string) (entity.ProfileHistory, error)
 }
 
 type service struct {
-	Repo repo.ProfileRepo
+	Repo  repo.ProfileRepo
+	Store objectstore.ObjectStore
 }
 
-// New creates new object of ProfileService
-func New(repo repo.ProfileRepo) ProfileService {
-	return &service{Repo: repo}
+// New creates new object of ProfileService, profile images are kept in store. Every method is traced.
+func New(repo repo.ProfileRepo, store objectstore.ObjectStore) ProfileService {
+	return &tracedService{next: &service{Repo: repo, Store: store}}
 }
 
-func (s *service) Create(profile entity.Profile) (string, error) {
-	zap.L().Info("receive create profile request",
+func (s *service) Create(ctx context.Context, profile entity.Profile) (string, error) {
+	tracing.Logger(ctx).Info("receive create profile request",
 		zap.String("profile_id", profile.ProfileID),
 		zap.String("tenant_id", profile.TenantID))
 
-	id, err := s.Repo.Create(profile)
+	err := validation.Struct(profile)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := s.Repo.Create(ctx, profile)
 
 	if err != nil {
-		zap.L().Error("error processing created profile request", zap.Error(err))
+		tracing.Logger(ctx).Error("error processing created profile request", zap.Error(err))
 		return "", err
 	}
 
 	return id, nil
 }
 
-func (s *service) Delete(profileID string, tenantID string) (bool, error) {
-	zap.L().Info("receive delete profile request",
+func (s *service) Delete(ctx context.Context, profileID string, tenantID string, version int64) (bool, error) {
+	tracing.Logger(ctx).Info("receive delete profile request",
 		zap.String("profile_id", profileID),
 		zap.String("tenant_id", tenantID))
 
-	status, err := s.Repo.Delete(profileID, tenantID)
+	status, err := s.Repo.Delete(ctx, profileID, tenantID, version)
+	if err == nil && !status {
+		err = repo.ErrNotFound
+	}
 
 	if err != nil {
-		zap.L().Error("error processing created profile request", zap.Error(err))
+		tracing.Logger(ctx).Error("error processing delete profile request", zap.Error(err))
 		return false, err
 	}
 
 	return status, nil
 }
 
-func (s *service) Search(query string, limit int, offset int, sortBy string, tenantID string) ([]entity.Profile, error) {
-	zap.L().Info("receive search profile request",
-		zap.String("query", query),
+func (s *service) Restore(ctx context.Context, profileID string, tenantID string) (bool, error) {
+	tracing.Logger(ctx).Info("receive restore profile request",
+		zap.String("profile_id", profileID),
 		zap.String("tenant_id", tenantID))
 
-	profiles, err := s.Repo.Search(query, limit, offset, sortBy, tenantID)
+	status, err := s.Repo.Restore(ctx, profileID, tenantID)
+	if err == nil && !status {
+		// only soft deleted profiles can be restored
+		err = repo.ErrNotFound
+	}
+
+	if err == nil {
+		// images of profiles deleted longer than the sweep grace period are already reclaimed
+		if err := s.dropSweptImage(ctx, profileID, tenantID); err != nil {
+			tracing.Logger(ctx).Warn("error clearing swept image of restored profile", zap.Error(err))
+		}
+	}
 
 	if err != nil {
-		zap.L().Error("error processing created profile request", zap.Error(err))
-		return nil, err
+		tracing.Logger(ctx).Error("error processing restore profile request", zap.Error(err))
+		return false, err
 	}
 
-	return profiles, nil
+	return status, nil
 }
 
-func (s *service) Update(filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (bool, error) {
-	zap.L().Info("receive update profile request")
+func (s *service) Purge(ctx context.Context, profileID string, tenantID string) (bool, error) {
+	tracing.Logger(ctx).Info("receive purge profile request",
+		zap.String("profile_id", profileID),
+		zap.String("tenant_id", tenantID))
 
-	status, err := s.Repo.Update(filters, fieldsToUpdate)
+	profile, err := s.Repo.Purge(ctx, profileID, tenantID)
 
 	if err != nil {
-		zap.L().Error("error processing update profile request", zap.Error(err))
+		tracing.Logger(ctx).Error("error processing purge profile request", zap.Error(err))
 		return false, err
 	}
 
-	return status, nil
+	// soft deleted profiles keep their images until the ImageSweeper reclaims them, purge removes them at once
+	s.deleteImage(ctx, profile.ProfileImageKey)
+
+	return true, nil
 }
 
-func (s *service) UploadProfileImage(profileID string, image []byte) (bool, error) {
-	zap.L().Info("receive upload profile image request")
+func (s *service) Get(ctx context.Context, profileID string, tenantID string) (entity.Profile, error) {
+	tracing.Logger(ctx).Info("receive get profile request",
+		zap.String("profile_id", profileID),
+		zap.String("tenant_id", tenantID))
 
-	status, err := s.Repo.UploadProfileImage(profileID, image)
+	profile, err := s.Repo.Get(ctx, profileID, tenantID)
 
 	if err != nil {
-		zap.L().Error("error processing update profile request", zap.Error(err))
-		return false, err
+		tracing.Logger(ctx).Error("error processing get profile request", zap.Error(err))
+		return entity.Profile{}, err
 	}
 
-	return status, nil
+	return profile, nil
+}
+
+func (s *service) Search(ctx context.Context, request entity.SearchProfileRequest, tenantID string) (entity.SearchProfileResponse, error) {
+	tracing.Logger(ctx).Info("receive search profile request",
+		zap.Any("filter", request.Filter),
+		zap.Bool("cursor", request.CursorMode()),
+		zap.String("tenant_id", tenantID))
+
+	page, err := s.Repo.Search(ctx, request, tenantID)
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing created profile request", zap.Error(err))
+		return entity.SearchProfileResponse{}, err
+	}
+
+	return page, nil
+}
+
+func (s *service) Update(ctx context.Context, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (int64, error) {
+	tracing.Logger(ctx).Info("receive update profile request")
+
+	version, err := s.Repo.Update(ctx, filters, fieldsToUpdate)
+	if err == nil && version == 0 {
+		err = repo.ErrNotFound
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing update profile request", zap.Error(err))
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// History returns a page of the audit trail of the profile, it is not found when the profile never had one
+func (s *service) History(ctx context.Context, profileID string, tenantID string, limit int, cursor string) (entity.ProfileHistory, error) {
+	tracing.Logger(ctx).Info("receive profile history request",
+		zap.String("profile_id", profileID),
+		zap.String("tenant_id", tenantID))
+
+	history, err := s.Repo.History(ctx, profileID, tenantID, limit, cursor)
+	if err == nil && len(history.Items) == 0 && len(cursor) == 0 {
+		err = repo.ErrNotFound
+	}
+
+	if err != nil {
+		tracing.Logger(ctx).Error("error processing profile history request", zap.Error(err))
+		return entity.ProfileHistory{}, err
+	}
+
+	return history, nil
 }
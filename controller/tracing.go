@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+
+	"n_users/entity"
+	"n_users/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracedService starts a span around every method of the wrapped ProfileService
+type tracedService struct {
+	next ProfileService
+}
+
+func profileAttributes(profileID string, tenantID string) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("profile.id", profileID), attribute.String("tenant.id", tenantID)}
+}
+
+func (t *tracedService) Create(ctx context.Context, profile entity.Profile) (id string, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Create", profileAttributes(profile.ProfileID, profile.TenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.Create(ctx, profile)
+}
+
+func (t *tracedService) Delete(ctx context.Context, profileID string, tenantID string, version int64) (status bool, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Delete", profileAttributes(profileID, tenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.Delete(ctx, profileID, tenantID, version)
+}
+
+func (t *tracedService) Restore(ctx context.Context, profileID string, tenantID string) (status bool, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Restore", profileAttributes(profileID, tenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.Restore(ctx, profileID, tenantID)
+}
+
+func (t *tracedService) Purge(ctx context.Context, profileID string, tenantID string) (status bool, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Purge", profileAttributes(profileID, tenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.Purge(ctx, profileID, tenantID)
+}
+
+func (t *tracedService) Get(ctx context.Context, profileID string, tenantID string) (profile entity.Profile, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Get", profileAttributes(profileID, tenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.Get(ctx, profileID, tenantID)
+}
+
+func (t *tracedService) Search(ctx context.Context, request entity.SearchProfileRequest, tenantID string) (page entity.SearchProfileResponse, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Search",
+		attribute.String("tenant.id", tenantID), attribute.Bool("search.cursor", request.CursorMode()))
+	defer func() {
+		span.SetAttributes(attribute.Int("search.results", len(page.Items)))
+		tracing.End(span, err)
+	}()
+	return t.next.Search(ctx, request, tenantID)
+}
+
+func (t *tracedService) Update(ctx context.Context, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (version int64, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Update")
+	defer func() { tracing.End(span, err) }()
+	return t.next.Update(ctx, filters, fieldsToUpdate)
+}
+
+func (t *tracedService) UploadProfileImage(ctx context.Context, profileID string, tenantID string, image []byte, version int64) (renditions entity.ImageRenditions, newVersion int64, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.UploadProfileImage",
+		append(profileAttributes(profileID, tenantID), attribute.Int("image.size", len(image)))...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.UploadProfileImage(ctx, profileID, tenantID, image, version)
+}
+
+func (t *tracedService) DeleteProfileImage(ctx context.Context, profileID string, tenantID string, version int64) (newVersion int64, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.DeleteProfileImage", profileAttributes(profileID, tenantID)...)
+	defer func() { tracing.End(span, err) }()
+	return t.next.DeleteProfileImage(ctx, profileID, tenantID, version)
+}
+
+func (t *tracedService) History(ctx context.Context, profileID string, tenantID string, limit int, cursor string) (history entity.ProfileHistory, err error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.History", profileAttributes(profileID, tenantID)...)
+	defer func() {
+		span.SetAttributes(attribute.Int("history.entries", len(history.Items)))
+		tracing.End(span, err)
+	}()
+	return t.next.History(ctx, profileID, tenantID, limit, cursor)
+}
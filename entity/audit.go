@@ -0,0 +1,79 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// actions recorded in the audit trail
+const (
+	AuditCreate      = "create"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditRestore     = "restore"
+	AuditPurge       = "purge"
+	AuditUploadImage = "upload_image"
+	AuditDeleteImage = "delete_image"
+)
+
+// AuditEntry records a change of a profile, entries are only ever appended
+type AuditEntry struct {
+	AuditID   int64  `json:"audit_id" gorm:"primary_key"`
+	TenantID  string `json:"-"`
+	ProfileID string `json:"profile_id"`
+	Action    string `json:"action"`
+	// Actor is the subject of the principal or service account that made the change
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id,omitempty"`
+	// Version is the profile version the change resulted in
+	Version   int64        `json:"version"`
+	Changes   FieldChanges `json:"changes" gorm:"type:jsonb"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// TableName of audit entries
+func (AuditEntry) TableName() string {
+	return "profile_audit"
+}
+
+// FieldChange holds values of a column before and after a change, nil when it had no value
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// FieldChanges maps column name to its change
+type FieldChanges map[string]FieldChange
+
+// Value stores changes as a json document
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Scan reads changes from a json document
+func (c *FieldChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+
+	return errors.New("unsupported field changes value")
+}
+
+// ProfileHistory is a page of the audit trail of a profile, newest entries first
+type ProfileHistory struct {
+	Items      []AuditEntry `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
@@ -1,31 +1,12 @@
 package entity
 
-import (
-	"encoding/json"
-	"time"
-)
-
-// ErrorResponse represents common error object
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+import "time"
 
 // SuccessResponse represents common success object
 type SuccessResponse struct {
 	Status string `json:"status"`
 }
 
-// NewError creates new object of ErrorResponse
-func NewError(s string) ErrorResponse {
-	return ErrorResponse{Error: s}
-}
-
-// NewErrorJSON creates new object of ErrorResponse and return byte array
-func NewErrorJSON(s string) ([]byte, error) {
-	e := ErrorResponse{Error: s}
-	return json.Marshal(e)
-}
-
 // RemoveEmptyValues remove empty entries from map
 func RemoveEmptyValues(m map[string]interface{}) map[string]interface{} {
 	for k, v := range m {
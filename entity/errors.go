@@ -0,0 +1,101 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorKind classifies domain errors, transports map it to their own status codes
+type ErrorKind string
+
+// supported error kinds
+const (
+	KindInternal           ErrorKind = "internal"
+	KindValidation         ErrorKind = "validation"
+	KindUnauthorized       ErrorKind = "unauthorized"
+	KindForbidden          ErrorKind = "forbidden"
+	KindNotFound           ErrorKind = "not_found"
+	KindConflict           ErrorKind = "conflict"
+	KindPreconditionFailed ErrorKind = "precondition_failed"
+	KindUnsupportedMedia   ErrorKind = "unsupported_media"
+	KindTooLarge           ErrorKind = "too_large"
+	KindUnavailable        ErrorKind = "unavailable"
+	KindTimeout            ErrorKind = "timeout"
+)
+
+// Error is a domain error returned by repo and controller. Code is a stable machine
+// readable identifier of the failure, clients should branch on it instead of Message.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+
+	if len(e.Message) == 0 {
+		return e.Err.Error()
+	}
+
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewDomainError creates new object of Error
+func NewDomainError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// WrapError creates new object of Error caused by err
+func WrapError(kind ErrorKind, code string, message string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+// AsDomainError returns the domain error in err chain, errors of unknown type are reported as internal
+func AsDomainError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return WrapError(KindInternal, "internal", "internal error", err)
+}
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is the cause of validation errors that list every invalid field
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, f := range e {
+		s = append(s, f.Field+" "+f.Message)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Problem represents RFC 7807 problem details of a failed request
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists invalid fields of validation problems
+	Errors []FieldError `json:"errors,omitempty"`
+	// TraceID identifies the trace of the failed request, it correlates the problem with logs and spans
+	TraceID string `json:"trace_id,omitempty"`
+}
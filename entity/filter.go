@@ -0,0 +1,65 @@
+package entity
+
+// Filter operators supported by the search filter language
+const (
+	FilterEq     = "eq"
+	FilterNe     = "ne"
+	FilterIn     = "in"
+	FilterPrefix = "prefix"
+	FilterRange  = "range"
+	FilterAnd    = "and"
+	FilterOr     = "or"
+	FilterNot    = "not"
+)
+
+// Filter represents one node of a structured search filter.
+//
+// Leaf nodes compare a field with a value, e.g.
+//
+//	{"field": "full_name", "op": "prefix", "value": "Nim"}
+//	{"field": "gender", "op": "in", "values": ["male", "female"]}
+//	{"field": "birth_date", "op": "range", "gte": "1990-01-01", "lt": "2000-01-01"}
+//
+// Logical nodes combine other filters, e.g.
+//
+//	{"op": "and", "filters": [...]}
+//	{"op": "not", "filters": [{...}]}
+type Filter struct {
+	Field   string        `json:"field,omitempty"`
+	Op      string        `json:"op"`
+	Value   interface{}   `json:"value,omitempty"`
+	Values  []interface{} `json:"values,omitempty"`
+	Gt      interface{}   `json:"gt,omitempty"`
+	Gte     interface{}   `json:"gte,omitempty"`
+	Lt      interface{}   `json:"lt,omitempty"`
+	Lte     interface{}   `json:"lte,omitempty"`
+	Filters []Filter      `json:"filters,omitempty"`
+}
+
+// GeoPoint represents a location on earth
+type GeoPoint struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// GeoBox represents a rectangle on earth, SouthWest longitude is greater than
+// NorthEast longitude when the box crosses the antimeridian
+type GeoBox struct {
+	SouthWest GeoPoint `json:"south_west"`
+	NorthEast GeoPoint `json:"north_east"`
+}
+
+// GeoQuery represents a location based search. Set Near with RadiusKM to search
+// within a radius, or Box to search inside a bounding box. Results are ordered by
+// distance from Near, or from the center of Box when Near is not set.
+type GeoQuery struct {
+	Near     *GeoPoint `json:"near"`
+	RadiusKM float64   `json:"radius_km"`
+	Box      *GeoBox   `json:"bbox"`
+}
+
+// TextQuery represents a relevance ranked search over name, email and address.
+// Words match by prefix and tolerate small typos.
+type TextQuery struct {
+	Query string `json:"query"`
+}
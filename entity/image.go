@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ImageRenditions maps rendition size in pixels, e.g. "256", to the public image url
+type ImageRenditions map[string]string
+
+// Value stores renditions as a json document
+func (r ImageRenditions) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+// Scan reads renditions from a json document
+func (r *ImageRenditions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	}
+
+	return errors.New("unsupported image renditions value")
+}
+
+// Largest returns url of the largest rendition, empty when there are no renditions
+func (r ImageRenditions) Largest() string {
+	url, largest := "", -1
+	for size, u := range r {
+		if n, err := strconv.Atoi(size); err == nil && n > largest {
+			url, largest = u, n
+		}
+	}
+	return url
+}
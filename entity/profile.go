@@ -2,21 +2,32 @@ package entity
 
 import "time"
 
-// Profile represents user profile object
+// Profile represents user profile object. EmailID and Mobile are stored normalized
+// and are unique among profiles of the tenant that are not deleted, see migration 0002.
 type Profile struct {
 	TenantID        string `json:"tenant_id" gorm:"primaryKey" validate:"required"`
 	ProfileID       string `json:"profile_id" gorm:"primaryKey" validate:"required"`
 	FullName        string `json:"full_name" validate:"required"`
 	Gender          string
-	EmailID         string `json:"email_id" gorm:"unique" validate:"required"`
-	Mobile          string `json:"mobile" gorm:"unique" validate:"required"`
+	EmailID         string `json:"email_id" validate:"required,email"`
+	Mobile          string `json:"mobile" validate:"required,e164"`
 	BirthDate       time.Time
 	CityID          string
 	CountryID       string
 	Address         string
-	Latitude        float64
-	Longitude       float64
+	Latitude        float64 `gorm:"index:idx_profile_location"`
+	Longitude       float64 `gorm:"index:idx_profile_location"`
 	ProfileImageURL string
+	// ProfileImageRenditions holds url of every resized variant of the profile image
+	ProfileImageRenditions ImageRenditions `json:"profile_image_renditions" gorm:"type:jsonb"`
+	// ProfileImageKey is the object store key prefix shared by all renditions of the profile image
+	ProfileImageKey string `json:"-" gorm:"index"`
+	// DistanceKM is set only on geo search results
+	DistanceKM *float64 `json:"distance_km,omitempty" gorm:"-"`
+	// Score is set only on text search results
+	Score *float64 `json:"score,omitempty" gorm:"-"`
+	// Version is incremented on every change and served as the profile ETag
+	Version int64 `json:"version" gorm:"not null;default:1"`
 	// who columns
 	Active    bool
 	CreatedBy string
@@ -29,14 +40,14 @@ type Profile struct {
 
 // CreateProfileRequest represent create profile request
 type CreateProfileRequest struct {
-	FullName  string `json:"full_name" validate:"required"`
-	Gender    string
-	EmailID   string `json:"email_id" validate:"required"`
-	Mobile    string
-	BirthDate time.Time `json:"birth_date" validate:"required"`
+	FullName  string    `json:"full_name" validate:"required"`
+	Gender    string    `json:"gender" validate:"omitempty,oneof=male female other undisclosed"`
+	EmailID   string    `json:"email_id" validate:"required,email"`
+	Mobile    string    `json:"mobile" validate:"required,e164"`
+	BirthDate time.Time `json:"birth_date" validate:"required,birthdate"`
 	CityID    string    `json:"city_id" validate:"required"`
 	CountryID string    `json:"country_id" validate:"required"`
-	Address   string
+	Address   string    `json:"address"`
 	Latitude  float64
 	Longitude float64
 }
@@ -47,20 +58,45 @@ type CreateProfileResponse struct {
 	ProfileID string
 }
 
-// UpdateProfileRequest represent update profile request
+// UpdateProfileRequest represent update profile request, empty fields are left unchanged
 type UpdateProfileRequest struct {
-	FullName  string `json:"full_name"`
-	Gender    string
-	EmailID   string `json:"email_id"`
-	Mobile    string
-	BirthDate time.Time `json:"birth_date"`
-	Address   string
+	FullName  string    `json:"full_name"`
+	Gender    string    `json:"gender" validate:"omitempty,oneof=male female other undisclosed"`
+	EmailID   string    `json:"email_id" validate:"omitempty,email"`
+	Mobile    string    `json:"mobile" validate:"omitempty,e164"`
+	BirthDate time.Time `json:"birth_date" validate:"omitempty,birthdate"`
+	Address   string    `json:"address"`
 }
 
 // SearchProfileRequest represent search profile request
 type SearchProfileRequest struct {
+	// Query is no longer supported and only kept to reject raw SQL from old clients
 	Query  string
-	SortBy string `json:"sort_by"`
+	Filter *Filter `json:"filter"`
+	// Geo restricts results to an area and orders them by distance
+	Geo *GeoQuery `json:"geo"`
+	// Text matches words in name, email and address and orders results by relevance
+	Text   *TextQuery `json:"text"`
+	SortBy string     `json:"sort_by"`
 	Limit  int64
 	Offset int64
+	// Pagination selects "offset" (default) or "cursor" based paging
+	Pagination string `json:"pagination"`
+	Cursor     string `json:"cursor"`
+	// IncludeTotal counts all matching profiles, it is only supported with cursor paging
+	IncludeTotal bool `json:"include_total"`
+	// IncludeDeleted also returns soft deleted profiles
+	IncludeDeleted bool `json:"include_deleted"`
+}
+
+// CursorMode reports whether request asks for cursor based paging
+func (r SearchProfileRequest) CursorMode() bool {
+	return r.Pagination == "cursor" || len(r.Cursor) > 0
+}
+
+// SearchProfileResponse represent one page of search profile results
+type SearchProfileResponse struct {
+	Items      []Profile `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	TotalCount *int64    `json:"total_count,omitempty"`
 }
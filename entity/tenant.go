@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Tenant statuses, only active tenants are served
+const (
+	TenantActive    = "active"
+	TenantSuspended = "suspended"
+)
+
+// Tenant is an entry of the tenant registry, profiles are only served for registered tenants
+type Tenant struct {
+	TenantID  string `gorm:"primaryKey"`
+	Name      string
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,161 @@
+package localstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"n_users/gateway/objectstore"
+)
+
+// LocalStore is an ObjectStore keeping objects as files under Config.Bucket directory
+type LocalStore struct {
+	Config objectstore.Config
+}
+
+// New creates new object of LocalStore, creating the root directory if required
+func New(cfg objectstore.Config) (*LocalStore, error) {
+	if err := os.MkdirAll(cfg.Bucket, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Config: cfg}, nil
+}
+
+// Put saves object under the key, writing to a temporary file first so that
+// readers never see a partially written object. Nothing is saved once ctx is done.
+func (l *LocalStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if err == nil && size >= 0 && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	// the body may have been read until the deadline passed
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns content of the object
+func (l *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, objectstore.ErrNotFound
+	}
+
+	return f, err
+}
+
+// Delete removes the object, deleting a missing object is not an error
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// List returns objects whose key starts with prefix, ordered by key
+func (l *LocalStore) List(ctx context.Context, prefix string) ([]objectstore.ObjectInfo, error) {
+	root := filepath.Clean(l.Config.Bucket)
+	infos := []objectstore.ObjectInfo{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// skip directories and uploads still being written
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		objectKey := filepath.ToSlash(rel)
+		key := strings.TrimPrefix(objectKey, l.Config.KeyPrefix)
+		if strings.HasPrefix(objectKey, l.Config.KeyPrefix) && strings.HasPrefix(key, prefix) {
+			infos = append(infos, objectstore.ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+// Ping checks that the root directory still exists
+func (l *LocalStore) Ping(ctx context.Context) error {
+	fi, err := os.Stat(l.Config.Bucket)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.New(l.Config.Bucket + " is not a directory")
+	}
+	return nil
+}
+
+// URL returns public url of the object
+func (l *LocalStore) URL(key string) string {
+	return l.Config.ObjectURL(key)
+}
+
+// path maps key to a file below the root directory, rejecting keys escaping it
+func (l *LocalStore) path(key string) (string, error) {
+	root := filepath.Clean(l.Config.Bucket)
+	path := filepath.Join(root, filepath.FromSlash(l.Config.ObjectKey(key)))
+
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", os.ErrInvalid
+	}
+
+	return path, nil
+}
@@ -0,0 +1,117 @@
+package localstore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"n_users/gateway/objectstore"
+)
+
+func TestPutGetDelete(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "localstore")
+	defer os.RemoveAll(dir)
+
+	l, err := New(objectstore.Config{Bucket: dir, KeyPrefix: "images/", PublicURLBase: "http://localhost/"})
+	if err != nil {
+		t.Fatalf("local store creation error %s", err)
+	}
+
+	if err := l.Put(context.Background(), "a.png", strings.NewReader("image"), 5, "image/png"); err != nil {
+		t.Fatalf("put error %s", err)
+	}
+
+	r, err := l.Get(context.Background(), "a.png")
+	if err != nil {
+		t.Fatalf("get error %s", err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+
+	if string(data) != "image" {
+		t.Errorf("object content is %q but expected image", data)
+	}
+
+	if url := l.URL("a.png"); url != "http://localhost/images/a.png" {
+		t.Errorf("object url is %s", url)
+	}
+
+	if err := l.Delete(context.Background(), "a.png"); err != nil {
+		t.Errorf("delete error %s", err)
+	}
+
+	if _, err := l.Get(context.Background(), "a.png"); err != objectstore.ErrNotFound {
+		t.Errorf("get after delete returned %v but expected not found", err)
+	}
+}
+
+func TestRejectsShortWrite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "localstore")
+	defer os.RemoveAll(dir)
+
+	l, _ := New(objectstore.Config{Bucket: dir})
+	if err := l.Put(context.Background(), "a.png", strings.NewReader("ima"), 5, "image/png"); err == nil {
+		t.Errorf("put of truncated body succeeded")
+	}
+
+	if _, err := l.Get(context.Background(), "a.png"); err != objectstore.ErrNotFound {
+		t.Errorf("truncated object was stored")
+	}
+}
+
+// cancelReader cancels the upload once the body was read
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c cancelReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		c.cancel()
+	}
+	return n, err
+}
+
+func TestCancelledPutIsNotStored(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "localstore")
+	defer os.RemoveAll(dir)
+
+	l, _ := New(objectstore.Config{Bucket: dir})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.Put(ctx, "a.png", cancelReader{strings.NewReader("image"), cancel}, 5, "image/png"); err != context.Canceled {
+		t.Errorf("put cancelled while reading body returned %v", err)
+	}
+
+	if _, err := l.Get(context.Background(), "a.png"); err != objectstore.ErrNotFound {
+		t.Errorf("cancelled upload was stored")
+	}
+}
+
+func TestRejectsKeysOutsideRoot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "localstore")
+	defer os.RemoveAll(dir)
+
+	l, _ := New(objectstore.Config{Bucket: dir})
+	if err := l.Put(context.Background(), "../escape.png", strings.NewReader("x"), 1, "image/png"); err == nil {
+		t.Errorf("put outside root directory succeeded")
+	}
+}
+
+func TestPing(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "localstore")
+	defer os.RemoveAll(dir)
+
+	l, _ := New(objectstore.Config{Bucket: dir})
+	if err := l.Ping(context.Background()); err != nil {
+		t.Errorf("ping error %s", err)
+	}
+
+	os.RemoveAll(dir)
+	if err := l.Ping(context.Background()); err == nil {
+		t.Errorf("ping succeeded after root directory was removed")
+	}
+}
@@ -0,0 +1,121 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"n_users/gateway/objectstore"
+)
+
+// Object represents an object held by the memory store
+type Object struct {
+	Data         []byte
+	ContentType  string
+	LastModified time.Time
+}
+
+// MemStore is an ObjectStore keeping objects in memory, meant for tests and local development
+type MemStore struct {
+	Config  objectstore.Config
+	mu      sync.RWMutex
+	objects map[string]Object
+}
+
+// New creates new object of MemStore
+func New(cfg objectstore.Config) *MemStore {
+	return &MemStore{Config: cfg, objects: map[string]Object{}}
+}
+
+// Put saves object under the key, nothing is saved once ctx is done
+func (m *MemStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[m.Config.ObjectKey(key)] = Object{Data: data, ContentType: contentType, LastModified: time.Now()}
+	return nil
+}
+
+// Get returns content of the object
+func (m *MemStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.objects[m.Config.ObjectKey(key)]
+	if !ok {
+		return nil, objectstore.ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(o.Data)), nil
+}
+
+// Delete removes the object, deleting a missing object is not an error
+func (m *MemStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, m.Config.ObjectKey(key))
+	return nil
+}
+
+// List returns objects whose key starts with prefix, ordered by key
+func (m *MemStore) List(ctx context.Context, prefix string) ([]objectstore.ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := []objectstore.ObjectInfo{}
+	for k, o := range m.objects {
+		key := strings.TrimPrefix(k, m.Config.KeyPrefix)
+		if strings.HasPrefix(k, m.Config.KeyPrefix) && strings.HasPrefix(key, prefix) {
+			infos = append(infos, objectstore.ObjectInfo{Key: key, Size: int64(len(o.Data)), LastModified: o.LastModified})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// SetLastModified changes modification time of the object, meant for tests
+func (m *MemStore) SetLastModified(key string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o, ok := m.objects[m.Config.ObjectKey(key)]; ok {
+		o.LastModified = t
+		m.objects[m.Config.ObjectKey(key)] = o
+	}
+}
+
+// Ping always succeeds, the store lives in memory
+func (m *MemStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// URL returns public url of the object
+func (m *MemStore) URL(key string) string {
+	return m.Config.ObjectURL(key)
+}
+
+// Objects returns a copy of all stored objects keyed by their prefixed key
+func (m *MemStore) Objects() map[string]Object {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	objects := make(map[string]Object, len(m.objects))
+	for k, v := range m.objects {
+		objects[k] = v
+	}
+	return objects
+}
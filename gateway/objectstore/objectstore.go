@@ -0,0 +1,54 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when object does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+// ObjectStore represents interface to save and serve binary objects like profile images
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	URL(key string) string
+	// Ping checks that the store is reachable and the bucket exists
+	Ping(ctx context.Context) error
+}
+
+// ObjectInfo describes a stored object, Key is relative to Config.KeyPrefix
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Config represents settings shared by all object store implementations
+type Config struct {
+	// Bucket is the S3 bucket name, or the root directory for the local store
+	Bucket string
+	// KeyPrefix is prepended to every object key, e.g. "images/"
+	KeyPrefix string
+	// PublicURLBase is prepended to the prefixed key to build public object url
+	PublicURLBase string
+}
+
+// ObjectKey returns the key under which object is stored
+func (c Config) ObjectKey(key string) string {
+	return c.KeyPrefix + key
+}
+
+// ObjectURL returns the public url of the object
+func (c Config) ObjectURL(key string) string {
+	base := c.PublicURLBase
+	if len(base) > 0 && !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + c.ObjectKey(key)
+}
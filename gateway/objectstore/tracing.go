@@ -0,0 +1,72 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStore starts a client span around every call to the wrapped ObjectStore
+type tracedStore struct {
+	next ObjectStore
+	kind string
+}
+
+// Traced wraps store so that its calls are traced, kind names the implementation, e.g. s3
+func Traced(store ObjectStore, kind string) ObjectStore {
+	return &tracedStore{next: store, kind: kind}
+}
+
+func (t *tracedStore) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("objectstore.kind", t.kind))
+	return otel.Tracer("n_users").Start(ctx, "ObjectStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil && err != ErrNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (err error) {
+	ctx, span := t.start(ctx, "Put", attribute.String("objectstore.key", key), attribute.Int64("objectstore.size", size))
+	defer func() { end(span, err) }()
+	return t.next.Put(ctx, key, body, size, contentType)
+}
+
+func (t *tracedStore) Get(ctx context.Context, key string) (_ io.ReadCloser, err error) {
+	ctx, span := t.start(ctx, "Get", attribute.String("objectstore.key", key))
+	defer func() { end(span, err) }()
+	return t.next.Get(ctx, key)
+}
+
+func (t *tracedStore) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := t.start(ctx, "Delete", attribute.String("objectstore.key", key))
+	defer func() { end(span, err) }()
+	return t.next.Delete(ctx, key)
+}
+
+func (t *tracedStore) List(ctx context.Context, prefix string) (infos []ObjectInfo, err error) {
+	ctx, span := t.start(ctx, "List", attribute.String("objectstore.prefix", prefix))
+	defer func() {
+		span.SetAttributes(attribute.Int("objectstore.objects", len(infos)))
+		end(span, err)
+	}()
+	return t.next.List(ctx, prefix)
+}
+
+func (t *tracedStore) URL(key string) string {
+	return t.next.URL(key)
+}
+
+// Ping is not traced, readiness probes would flood traces
+func (t *tracedStore) Ping(ctx context.Context) error {
+	return t.next.Ping(ctx)
+}
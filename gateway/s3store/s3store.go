@@ -2,41 +2,112 @@ package s3store
 
 import (
 	"bytes"
-	"mime/multipart"
-	"net/http"
-	"path/filepath"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"n_users/gateway/objectstore"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/google/uuid"
 )
 
-// UploadFileToS3 saves a file to aws bucket and returns the url
-func UploadFileToS3(s *session.Session, file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
+// S3Store is an ObjectStore keeping objects in an aws s3 bucket
+type S3Store struct {
+	Config objectstore.Config
+	Client *s3.S3
+}
 
-	// Read the content from file into a buffer
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
+// New creates new object of S3Store
+func New(s *session.Session, cfg objectstore.Config) *S3Store {
+	return &S3Store{Config: cfg, Client: s3.New(s)}
+}
 
-	fileName := "images/" + uuid.New().String() + filepath.Ext(fileHeader.Filename)
+// Put saves object to the bucket, the upload is aborted when ctx is done
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	rs, ok := body.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		rs = bytes.NewReader(data)
+	}
 
-	_, err := s3.New(s).PutObject(&s3.PutObjectInput{
-		Bucket:               aws.String("images.repo.bucket1"),
-		Key:                  aws.String(fileName),
+	_, err := s.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.Config.Bucket),
+		Key:                  aws.String(s.Config.ObjectKey(key)),
 		ACL:                  aws.String("public-read"),
-		Body:                 bytes.NewReader(buffer),
-		ContentLength:        aws.Int64(int64(size)),
-		ContentType:          aws.String(http.DetectContentType(buffer)),
+		Body:                 rs,
+		ContentLength:        aws.Int64(size),
+		ContentType:          aws.String(contentType),
 		ContentDisposition:   aws.String("attachment"),
 		ServerSideEncryption: aws.String("AES256"),
 		StorageClass:         aws.String("INTELLIGENT_TIERING"),
 	})
 
+	return err
+}
+
+// Get returns content of the object
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(s.Config.ObjectKey(key)),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, objectstore.ErrNotFound
+	}
+
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fileName, err
+	return out.Body, nil
+}
+
+// Delete removes the object, deleting a missing object is not an error
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Config.Bucket),
+		Key:    aws.String(s.Config.ObjectKey(key)),
+	})
+
+	return err
+}
+
+// List returns objects whose key starts with prefix, ordered by key
+func (s *S3Store) List(ctx context.Context, prefix string) ([]objectstore.ObjectInfo, error) {
+	infos := []objectstore.ObjectInfo{}
+
+	err := s.Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Config.Bucket),
+		Prefix: aws.String(s.Config.ObjectKey(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			infos = append(infos, objectstore.ObjectInfo{
+				Key:          strings.TrimPrefix(aws.StringValue(o.Key), s.Config.KeyPrefix),
+				Size:         aws.Int64Value(o.Size),
+				LastModified: aws.TimeValue(o.LastModified),
+			})
+		}
+		return true
+	})
+
+	return infos, err
+}
+
+// Ping checks that the bucket exists and is accessible
+func (s *S3Store) Ping(ctx context.Context) error {
+	_, err := s.Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.Config.Bucket)})
+	return err
+}
+
+// URL returns public url of the object
+func (s *S3Store) URL(key string) string {
+	return s.Config.ObjectURL(key)
 }
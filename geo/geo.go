@@ -0,0 +1,105 @@
+package geo
+
+import "math"
+
+// EarthRadiusKM is the mean earth radius used for all distance calculations
+const EarthRadiusKM = 6371.0088
+
+// Bounds represents a latitude/longitude rectangle.
+// MinLongitude is greater than MaxLongitude when the rectangle crosses the antimeridian.
+type Bounds struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Distance returns great circle distance in km between two points using the haversine formula.
+// repo.distanceSQL evaluates the same formula inside Postgres, keep both in sync.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * EarthRadiusKM * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// BoundsAround returns smallest rectangle containing the circle of radiusKM around the point
+func BoundsAround(lat, lon, radiusKM float64) Bounds {
+	dLat := degrees(radiusKM / EarthRadiusKM)
+
+	b := Bounds{MinLatitude: lat - dLat, MaxLatitude: lat + dLat}
+
+	// circle covers a pole, every longitude is in range
+	if b.MinLatitude <= -90 || b.MaxLatitude >= 90 {
+		b.MinLatitude = math.Max(b.MinLatitude, -90)
+		b.MaxLatitude = math.Min(b.MaxLatitude, 90)
+		b.MinLongitude, b.MaxLongitude = -180, 180
+		return b
+	}
+
+	dLon := degrees(math.Asin(math.Sin(radiusKM/EarthRadiusKM) / math.Cos(radians(lat))))
+	if radiusKM/EarthRadiusKM >= math.Pi/2 || dLon >= 180 {
+		b.MinLongitude, b.MaxLongitude = -180, 180
+		return b
+	}
+
+	b.MinLongitude = normalizeLongitude(lon - dLon)
+	b.MaxLongitude = normalizeLongitude(lon + dLon)
+	return b
+}
+
+// Contains reports whether point lies inside the bounds
+func (b Bounds) Contains(lat, lon float64) bool {
+	if lat < b.MinLatitude || lat > b.MaxLatitude {
+		return false
+	}
+
+	if b.CrossesAntimeridian() {
+		return lon >= b.MinLongitude || lon <= b.MaxLongitude
+	}
+
+	return lon >= b.MinLongitude && lon <= b.MaxLongitude
+}
+
+// CrossesAntimeridian reports whether bounds wrap around longitude 180
+func (b Bounds) CrossesAntimeridian() bool {
+	return b.MinLongitude > b.MaxLongitude
+}
+
+// Center returns mid point of the bounds
+func (b Bounds) Center() (float64, float64) {
+	lat := (b.MinLatitude + b.MaxLatitude) / 2
+
+	maxLon := b.MaxLongitude
+	if b.CrossesAntimeridian() {
+		maxLon += 360
+	}
+
+	return lat, normalizeLongitude((b.MinLongitude + maxLon) / 2)
+}
+
+// ValidPoint reports whether latitude and longitude are within their ranges
+func ValidPoint(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+func normalizeLongitude(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
@@ -0,0 +1,53 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// Bengaluru to Mumbai
+	d := Distance(12.9716, 77.5946, 19.0760, 72.8777)
+	if math.Abs(d-845) > 5 {
+		t.Errorf("distance is %f km but expected about 845 km", d)
+	}
+
+	if d := Distance(12.9716, 77.5946, 12.9716, 77.5946); d != 0 {
+		t.Errorf("distance to same point is %f but expected 0", d)
+	}
+}
+
+func TestBoundsAround(t *testing.T) {
+	b := BoundsAround(12.9716, 77.5946, 10)
+	if b.CrossesAntimeridian() {
+		t.Errorf("bounds %v should not cross antimeridian", b)
+	}
+
+	// every point on the circle must be inside the bounds
+	for bearing := 0.0; bearing < 360; bearing += 15 {
+		lat, lon := destination(12.9716, 77.5946, bearing, 10)
+		if !b.Contains(lat, lon) {
+			t.Errorf("bounds %v do not contain point %f, %f", b, lat, lon)
+		}
+	}
+
+	b = BoundsAround(0, 179.99, 50)
+	if !b.CrossesAntimeridian() || !b.Contains(0, -179.9) {
+		t.Errorf("bounds %v should wrap around antimeridian", b)
+	}
+
+	b = BoundsAround(89.9, 0, 50)
+	if b.MinLongitude != -180 || b.MaxLongitude != 180 {
+		t.Errorf("bounds %v around pole should cover all longitudes", b)
+	}
+}
+
+func destination(lat, lon, bearing, distanceKM float64) (float64, float64) {
+	d := distanceKM / EarthRadiusKM
+	lat1, lon1, br := radians(lat), radians(lon), radians(bearing)
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(br))
+	lon2 := lon1 + math.Atan2(math.Sin(br)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	return degrees(lat2), normalizeLongitude(degrees(lon2))
+}
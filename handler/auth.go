@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"n_users/auth"
+	"n_users/entity"
+	"n_users/tenant"
+	"n_users/tracing"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Authenticate returns middleware rejecting requests without a valid bearer token with 401.
+// The principal of the token is stored in the request context of authenticated requests.
+func Authenticate(authn *auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="n_users"`)
+				writeError(w, r, entity.NewDomainError(entity.KindUnauthorized, "missing_token", "bearer token is required"))
+				return
+			}
+
+			p, err := authn.Authenticate(r.Context(), token)
+			if err != nil {
+				// the reason is only logged, it would help forging tokens
+				tracing.Logger(r.Context()).Info("rejected bearer token", zap.String("path", r.URL.Path), zap.Error(err))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="n_users", error="invalid_token"`)
+				writeError(w, r, entity.NewDomainError(entity.KindUnauthorized, "invalid_token", "bearer token is invalid or expired"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// authorize returns middleware answering 403 to principals the policy does not allow. Routes
+// addressing a profile name its id {ProfileID}, self policies match it with the principal.
+func authorize(policy auth.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				writeError(w, r, entity.NewDomainError(entity.KindUnauthorized, "missing_token", "bearer token is required"))
+				return
+			}
+
+			profileID := chi.URLParam(r, "ProfileID")
+			if !policy.Allow(p, profileID) {
+				tracing.Logger(r.Context()).Warn("denied request",
+					zap.String("subject", p.Subject),
+					zap.Strings("scopes", p.Scopes),
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.String("profile_id", profileID),
+					zap.Strings("required_scopes", policy.Scopes),
+					zap.Strings("self_scopes", policy.SelfScopes))
+				writeError(w, r, entity.NewDomainError(entity.KindForbidden, "access_denied", "not allowed to "+r.Method+" this profile"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resolveTenant returns middleware storing the tenant of the request in its context. Requests of
+// missing, unknown or suspended tenants are rejected before reaching a handler.
+func resolveTenant(tenants *tenant.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := tenants.Resolve(r)
+			if err != nil {
+				if e := entity.AsDomainError(err); e.Kind == entity.KindForbidden {
+					p, _ := auth.FromContext(r.Context())
+					tracing.Logger(r.Context()).Warn("rejected tenant",
+						zap.String("subject", p.Subject),
+						zap.String("token_tenant", p.Tenant),
+						zap.String("code", e.Code))
+				}
+				writeError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), id)))
+		})
+	}
+}
+
+// tenantID returns the tenant stored by resolveTenant
+func tenantID(r *http.Request) string {
+	id, _ := tenant.FromContext(r.Context())
+	return id
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(header[7:])
+	return token, len(token) > 0
+}
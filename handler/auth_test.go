@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"n_users/auth"
+	"n_users/config"
+	"n_users/controller"
+	"n_users/entity"
+	"n_users/gateway/memstore"
+	"n_users/gateway/objectstore"
+	"n_users/mocks"
+	"n_users/repo"
+	"n_users/tenant"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAuthenticate(t *testing.T) {
+	authn := &auth.Authenticator{Issuer: "https://issuer", Audience: "n_users", TenantClaim: "tenant", Secret: []byte("dev")}
+
+	var principal auth.Principal
+	h := Authenticate(authn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.FromContext(r.Context())
+	}))
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://issuer", "aud": "n_users", "sub": "user-1", "tenant": "acme",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("dev"))
+
+	req := httptest.NewRequest(http.MethodGet, "/profiles/1", nil)
+	req.Header.Set("Authorization", "bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || principal.Subject != "user-1" || principal.Tenant != "acme" {
+		t.Errorf("status is %d and principal %+v but expected user-1 of acme", w.Code, principal)
+	}
+
+	for name, header := range map[string]string{
+		"missing_token": "",
+		"invalid_token": "Bearer " + token[:len(token)-2],
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/profiles/1", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var p entity.Problem
+		json.NewDecoder(w.Body).Decode(&p)
+
+		if w.Code != http.StatusUnauthorized || p.Code != name || len(w.Header().Get("WWW-Authenticate")) == 0 {
+			t.Errorf("%s request answered %d %+v", name, w.Code, p)
+		}
+	}
+}
+
+var admin = auth.Principal{Subject: "admin", Scopes: []string{auth.ScopeAdmin}}
+
+// as returns r made by principal p of the default tenant
+func as(r *http.Request, p auth.Principal) *http.Request {
+	return r.WithContext(tenant.WithID(auth.WithPrincipal(r.Context(), p), "default"))
+}
+
+func asAdmin(r *http.Request) *http.Request {
+	return as(r, admin)
+}
+
+func TestProfileRoutePolicies(t *testing.T) {
+	reader := auth.Principal{Subject: "reader", Scopes: []string{auth.ScopeRead}}
+	owner := auth.Principal{Subject: "201", Scopes: []string{auth.ScopeWrite}}
+	other := auth.Principal{Subject: "202", Scopes: []string{auth.ScopeWrite}}
+	scopeless := auth.Principal{Subject: "201"}
+
+	cases := []struct {
+		name      string
+		method    string
+		path      string
+		principal auth.Principal
+		denied    bool
+	}{
+		{"reader gets any profile", http.MethodGet, "/201", reader, false},
+		{"reader searches", http.MethodPost, "/_search", reader, false},
+		{"reader can not update", http.MethodPut, "/201", reader, true},
+		{"reader can not create", http.MethodPost, "/", reader, true},
+		{"owner gets own profile", http.MethodGet, "/201", owner, false},
+		{"owner updates own profile", http.MethodPut, "/201", owner, false},
+		{"owner uploads own image", http.MethodPut, "/201/_upload", owner, false},
+		{"owner can not search", http.MethodPost, "/_search", owner, true},
+		{"other user can not get", http.MethodGet, "/201", other, true},
+		{"other user can not delete", http.MethodDelete, "/201", other, true},
+		{"other user can not delete image", http.MethodDelete, "/201/image", other, true},
+		{"other user can not restore", http.MethodPost, "/201/_restore", other, true},
+		{"self without scope is denied", http.MethodPut, "/201", scopeless, true},
+		{"admin deletes any profile", http.MethodDelete, "/201", admin, false},
+		{"owner can not read history", http.MethodGet, "/201/_history", owner, true},
+		{"reader can not read history", http.MethodGet, "/201/_history", reader, true},
+		{"admin reads history", http.MethodGet, "/201/_history", admin, false},
+	}
+
+	// allowed requests fail later on the invalid body or missing profile, denied ones never reach the repo
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(entity.Profile{}, repo.ErrNotFound).AnyTimes()
+	mockProfileRepo.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	mockProfileRepo.EXPECT().History(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(entity.ProfileHistory{}, nil).AnyTimes()
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader("{"))
+		w := httptest.NewRecorder()
+		h.NewProfileRouter().ServeHTTP(w, as(req, c.principal))
+
+		var p entity.Problem
+		json.NewDecoder(w.Body).Decode(&p)
+
+		if denied := w.Code == http.StatusForbidden && p.Code == "access_denied"; denied != c.denied {
+			t.Errorf("%s: response %d %+v", c.name, w.Code, p)
+		}
+	}
+}
+
+func TestCreateProfileKeysUserProfileBySubject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, p entity.Profile) (string, error) {
+		return p.ProfileID, nil
+	}).Times(2)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, as(GetCreateProfileRequest(), auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeWrite}}))
+
+	var sr entity.CreateProfileResponse
+	if err := json.NewDecoder(w.Body).Decode(&sr); err != nil || sr.ProfileID != "user-1" {
+		t.Errorf("user created profile %s, %v but expected it keyed by subject", sr.ProfileID, err)
+	}
+
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(GetCreateProfileRequest()))
+
+	if err := json.NewDecoder(w.Body).Decode(&sr); err != nil || sr.ProfileID == "admin" || len(sr.ProfileID) == 0 {
+		t.Errorf("admin created profile %s, %v but expected a generated id", sr.ProfileID, err)
+	}
+}
+
+func TestProfileRouterResolvesTenant(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().GetTenant(gomock.Any(), "acme").Return(entity.Tenant{TenantID: "acme", Status: entity.TenantActive}, nil).Times(1)
+	mockProfileRepo.EXPECT().GetTenant(gomock.Any(), "globex").Return(entity.Tenant{TenantID: "globex", Status: entity.TenantSuspended}, nil).Times(1)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "201", "acme").Return(entity.Profile{ProfileID: "201", TenantID: "acme"}, nil).Times(2)
+
+	h := &profileHandler{
+		ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{})),
+		Tenants:        tenant.NewResolver(config.TenantsConfig{Source: "claim"}, tenant.NewRegistry(mockProfileRepo.GetTenant, time.Minute)),
+	}
+
+	cases := map[string]struct {
+		tenant string
+		status int
+	}{
+		"active":    {"acme", http.StatusOK},
+		"suspended": {"globex", http.StatusForbidden},
+		"missing":   {"", http.StatusBadRequest},
+	}
+
+	for name, c := range cases {
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/201", nil)
+			req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "reader", Tenant: c.tenant, Scopes: []string{auth.ScopeRead}}))
+			w := httptest.NewRecorder()
+			h.NewProfileRouter().ServeHTTP(w, req)
+
+			if w.Code != c.status {
+				t.Errorf("%s tenant request answered %d but expected %d", name, w.Code, c.status)
+			}
+		}
+	}
+}
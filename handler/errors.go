@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"n_users/entity"
+	"n_users/tracing"
+
+	"go.uber.org/zap"
+)
+
+// problemTypePrefix prefixes error code in the type of every problem response
+const problemTypePrefix = "urn:n_users:problem:"
+
+// kindStatus maps domain error kinds to HTTP status codes
+var kindStatus = map[entity.ErrorKind]int{
+	entity.KindInternal:           http.StatusInternalServerError,
+	entity.KindValidation:         http.StatusBadRequest,
+	entity.KindUnauthorized:       http.StatusUnauthorized,
+	entity.KindForbidden:          http.StatusForbidden,
+	entity.KindNotFound:           http.StatusNotFound,
+	entity.KindConflict:           http.StatusConflict,
+	entity.KindPreconditionFailed: http.StatusPreconditionFailed,
+	entity.KindUnsupportedMedia:   http.StatusUnsupportedMediaType,
+	entity.KindTooLarge:           http.StatusRequestEntityTooLarge,
+	entity.KindUnavailable:        http.StatusServiceUnavailable,
+	entity.KindTimeout:            http.StatusGatewayTimeout,
+}
+
+// writeError writes err as RFC 7807 problem details with the status code of its kind.
+// Causes of internal and unavailable errors are only logged, they are never sent to clients.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := entity.AsDomainError(err)
+
+	// stores fail in their own ways once the deadline of the request passed or the client went away
+	if r.Context().Err() != nil && (e.Kind == entity.KindInternal || e.Kind == entity.KindUnavailable) {
+		e = timeoutError(r.Context().Err())
+	}
+
+	status, ok := kindStatus[e.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	detail := e.Error()
+	if status >= http.StatusInternalServerError {
+		detail = e.Message
+		tracing.Logger(r.Context()).Error("error processing request",
+			zap.String("path", r.URL.Path),
+			zap.String("code", e.Code),
+			zap.Error(err))
+	}
+
+	p := entity.Problem{
+		Type:     problemTypePrefix + e.Code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+		TraceID:  tracing.TraceID(r.Context()),
+	}
+
+	var fields entity.FieldErrors
+	if errors.As(err, &fields) {
+		p.Errors = fields
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	res, _ := json.Marshal(p)
+	w.Write(res)
+}
+
+// invalidRequest returns validation error of a request body that could not be decoded
+func invalidRequest(err error) error {
+	return entity.WrapError(entity.KindValidation, "invalid_request_body", "invalid request body", err)
+}
+
+// timeoutError returns the error of a request cancelled by its deadline or by the client
+func timeoutError(err error) *entity.Error {
+	return entity.WrapError(entity.KindTimeout, "request_timeout", "request timed out", err)
+}
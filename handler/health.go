@@ -3,6 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
+
+	"n_users/health"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -11,14 +14,23 @@ import (
 type HealthHandler interface {
 	Home(w http.ResponseWriter, r *http.Request)
 	Health(w http.ResponseWriter, r *http.Request)
+	// Live reports that the process is running, it does not check dependencies
+	Live(w http.ResponseWriter, r *http.Request)
+	// Ready reports every dependency check and fails when a critical one is down
+	Ready(w http.ResponseWriter, r *http.Request)
+	// Drain makes health fail, so that load balancers stop routing requests before shutdown
+	Drain()
 	NewHealthRouter() http.Handler
 }
 
-type healthHandler struct{}
+type healthHandler struct {
+	Checker  *health.Checker
+	draining int32
+}
 
-// NewHealthHandler creates new object of HealthHandler
-func NewHealthHandler() HealthHandler {
-	return &healthHandler{}
+// NewHealthHandler creates new object of HealthHandler reporting checks registered with checker
+func NewHealthHandler(checker *health.Checker) HealthHandler {
+	return &healthHandler{Checker: checker}
 }
 
 // NewHealthRouter constructs new router for health endpoints
@@ -27,6 +39,8 @@ func (hh *healthHandler) NewHealthRouter() http.Handler {
 
 	r.Get("/", hh.Home)
 	r.Get("/_health", hh.Health)
+	r.Get("/_live", hh.Live)
+	r.Get("/_ready", hh.Ready)
 	return r
 }
 
@@ -41,13 +55,60 @@ func (hh *healthHandler) Home(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
+// Health is kept for existing monitors, it is green while the service is ready
 func (hh *healthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	type health struct {
 		Status string
 	}
 
 	h := health{Status: "green"}
+	if hh.isDraining() {
+		h.Status = "draining"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if !hh.report(r).Ready() {
+		h.Status = "red"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 
 	res, _ := json.Marshal(h)
 	w.Write(res)
 }
+
+func (hh *healthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	type live struct {
+		Status string `json:"status"`
+	}
+
+	res, _ := json.Marshal(live{Status: health.StatusUp})
+	w.Write(res)
+}
+
+func (hh *healthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := hh.report(r)
+	if hh.isDraining() {
+		report.Status = "draining"
+	}
+
+	if hh.isDraining() || !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	res, _ := json.Marshal(report)
+	w.Write(res)
+}
+
+func (hh *healthHandler) Drain() {
+	atomic.StoreInt32(&hh.draining, 1)
+}
+
+func (hh *healthHandler) isDraining() bool {
+	return atomic.LoadInt32(&hh.draining) == 1
+}
+
+// report runs the checks, a handler without checker has no dependencies to report
+func (hh *healthHandler) report(r *http.Request) health.Report {
+	if hh.Checker == nil {
+		return health.Report{Status: health.StatusUp, Checks: []health.Result{}}
+	}
+	return hh.Checker.Run(r.Context())
+}
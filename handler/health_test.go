@@ -1,10 +1,15 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"n_users/health"
 )
 
 func TestHome(t *testing.T) {
@@ -13,7 +18,7 @@ func TestHome(t *testing.T) {
 
 	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/", nil)
 
-	NewHealthHandler().NewHealthRouter().ServeHTTP(w, req)
+	NewHealthHandler(health.NewChecker(0)).NewHealthRouter().ServeHTTP(w, req)
 	resp := w.Result()
 
 	if resp.StatusCode != http.StatusOK {
@@ -39,7 +44,7 @@ func TestHealth(t *testing.T) {
 
 	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/_health", nil)
 
-	NewHealthHandler().NewHealthRouter().ServeHTTP(w, req)
+	NewHealthHandler(health.NewChecker(0)).NewHealthRouter().ServeHTTP(w, req)
 	resp := w.Result()
 
 	if resp.StatusCode != http.StatusOK {
@@ -58,3 +63,81 @@ func TestHealth(t *testing.T) {
 		t.Errorf("health response status is %s but expected true", sr.Status)
 	}
 }
+
+func TestHealthWhileDraining(t *testing.T) {
+	hh := NewHealthHandler(health.NewChecker(0))
+	hh.Drain()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/_health", nil)
+	hh.NewHealthRouter().ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health while draining didn’t respond 503: %s", w.Result().Status)
+	}
+}
+
+func TestLive(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.Register("postgres", true, time.Second, func(ctx context.Context) error { return errors.New("down") })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/_live", nil)
+	NewHealthHandler(checker).NewHealthRouter().ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("live didn’t respond 200 OK with a failing dependency: %s", w.Result().Status)
+	}
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		critical error
+		optional error
+		status   int
+		report   string
+	}{
+		{name: "all up", status: http.StatusOK, report: health.StatusUp},
+		{name: "optional down", optional: errors.New("bucket missing"), status: http.StatusOK, report: health.StatusDegraded},
+		{name: "critical down", critical: errors.New("connection refused"), status: http.StatusServiceUnavailable, report: health.StatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(0)
+			checker.Register("postgres", true, time.Second, func(ctx context.Context) error { return tt.critical })
+			checker.Register("object_store", false, time.Second, func(ctx context.Context) error { return tt.optional })
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/_ready", nil)
+			NewHealthHandler(checker).NewHealthRouter().ServeHTTP(w, req)
+
+			if w.Result().StatusCode != tt.status {
+				t.Errorf("ready responded %s, expected %d", w.Result().Status, tt.status)
+			}
+
+			var report health.Report
+			if err := json.NewDecoder(w.Result().Body).Decode(&report); err != nil {
+				t.Fatalf("ready response parsing error %s", err)
+			}
+
+			if report.Status != tt.report || len(report.Checks) != 2 {
+				t.Errorf("ready reported %+v, expected status %s with 2 checks", report, tt.report)
+			}
+		})
+	}
+}
+
+func TestReadyWhileDraining(t *testing.T) {
+	hh := NewHealthHandler(health.NewChecker(0))
+	hh.Drain()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/_ready", nil)
+	hh.NewHealthRouter().ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ready while draining didn’t respond 503: %s", w.Result().Status)
+	}
+}
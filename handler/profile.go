@@ -1,16 +1,30 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 
+	"n_users/audit"
+	"n_users/auth"
+	"n_users/config"
 	"n_users/controller"
 	"n_users/entity"
+	"n_users/health"
 	"n_users/mappers"
+	"n_users/metrics"
+	"n_users/tenant"
+	"n_users/validation"
 
+	"n_users/gateway/localstore"
+	"n_users/gateway/memstore"
+	"n_users/gateway/objectstore"
 	"n_users/gateway/s3store"
 	"n_users/repo"
 
@@ -18,61 +32,136 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-const maxUploadFileSize = int64(2 * 1024000)
-const s3ImagePrefix = "https://s3.ap-south-1.amazonaws.com/images.repo.bucket1/"
+const defaultMaxUploadSize = int64(2 * 1024000)
+const maxMultipartOverhead = int64(64 * 1024)
+
+var uploadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "n_users_image_upload_bytes",
+	Help:    "Size of accepted profile image uploads by tenant.",
+	Buckets: prometheus.ExponentialBuckets(16*1024, 2, 8),
+}, []string{"tenant"})
 
 // ProfileHandler handles profile endpoints
 type ProfileHandler interface {
 	CreateProfile(w http.ResponseWriter, r *http.Request)
 	DeleteProfile(w http.ResponseWriter, r *http.Request)
+	RestoreProfile(w http.ResponseWriter, r *http.Request)
+	GetProfile(w http.ResponseWriter, r *http.Request)
 	SearchProfile(w http.ResponseWriter, r *http.Request)
 	UpdateProfile(w http.ResponseWriter, r *http.Request)
 	UploadProfileImage(w http.ResponseWriter, r *http.Request)
+	DeleteProfileImage(w http.ResponseWriter, r *http.Request)
+	ProfileHistory(w http.ResponseWriter, r *http.Request)
 	NewProfileRouter() http.Handler
+	// Close stops background work and releases the database pool
+	Close() error
 }
 
 type profileHandler struct {
 	ProfileService controller.ProfileService
-	AWSSession     *session.Session
+	// AdminKey authorizes admin only operations like purge, admin operations are disabled when empty
+	AdminKey string
+	// MaxUploadSize limits size of uploaded images in bytes, defaultMaxUploadSize when zero
+	MaxUploadSize int64
+	// Tenants resolves the tenant of every request, requests carry it in their context when nil
+	Tenants *tenant.Resolver
+	// Masker hides PII in profile history, history is served unmasked when nil
+	Masker *audit.Masker
+	// Repo and StopSweeper are released by Close
+	Repo        repo.ProfileRepo
+	StopSweeper func()
 }
 
-// NewProfileHandler creates ProfileHandler
-func NewProfileHandler() ProfileHandler {
-	url := os.Getenv("POSTGRE_URL_VALUE")
-	pr, err := repo.New("postgres", url)
+// NewProfileHandler creates ProfileHandler, registering checks of its database and object store with checker
+func NewProfileHandler(cfg config.Config, checker *health.Checker) ProfileHandler {
+	pr, err := repo.New("postgres", cfg.Database)
 
 	if err != nil {
 		log.Fatal("error init profile handler", err)
 	}
 
-	// Create an AWS session
-	AWSRegion := os.Getenv("AWS_REGION")
-	AWSSecretID := os.Getenv("AWS_SECRET_ID")
-	AWSSecret := os.Getenv("AWS_SECRET")
-	s, err := session.NewSession(&aws.Config{
-		Region:      aws.String(AWSRegion),
-		Credentials: credentials.NewStaticCredentials(AWSSecretID, AWSSecret, ""),
-	})
-
+	store, err := newObjectStore(cfg.ObjectStore)
 	if err != nil {
-		// TODO: check if regular session refresh is required?
-		log.Fatal("error creating AWS session", err)
+		log.Fatal("error creating object store", err)
 	}
+	store = objectstore.Traced(store, cfg.ObjectStore.Kind)
+
+	// profiles can not be served without the database, images are optional
+	checker.Register("postgres", true, cfg.Health.CheckTimeout, pr.Ping)
+	checker.Register("object_store", false, cfg.Health.CheckTimeout, store.Ping)
+
+	tenants := tenant.NewResolver(cfg.Tenants, tenant.NewRegistry(pr.GetTenant, cfg.Tenants.CacheTTL))
+
+	stopSweeper := controller.NewImageSweeper(pr, store, cfg.Images.SweepGracePeriod).Start(cfg.Images.SweepInterval)
 
-	return &profileHandler{ProfileService: controller.New(pr), AWSSession: s}
+	return &profileHandler{
+		ProfileService: controller.New(pr, store),
+		AdminKey:       string(cfg.AdminAPIKey),
+		MaxUploadSize:  cfg.Images.MaxUploadSize,
+		Tenants:        tenants,
+		Masker:         audit.NewMasker(cfg.Audit),
+		Repo:           pr,
+		StopSweeper:    stopSweeper,
+	}
+}
+
+func (h *profileHandler) Close() error {
+	if h.StopSweeper != nil {
+		h.StopSweeper()
+	}
+
+	if h.Repo != nil {
+		h.Repo.SafeClose()
+	}
+
+	return nil
+}
+
+// newObjectStore creates object store for profile images of the configured kind
+func newObjectStore(cfg config.ObjectStoreConfig) (objectstore.ObjectStore, error) {
+	switch cfg.Kind {
+	case "memory":
+		return memstore.New(cfg.StoreConfig()), nil
+	case "local":
+		return localstore.New(cfg.StoreConfig())
+	case "s3":
+		// Create an AWS session
+		s, err := session.NewSession(&aws.Config{
+			Region:      aws.String(cfg.AWSRegion),
+			Credentials: credentials.NewStaticCredentials(string(cfg.AWSAccessKeyID), string(cfg.AWSSecretAccessKey), ""),
+		})
+
+		if err != nil {
+			// TODO: check if regular session refresh is required?
+			return nil, err
+		}
+
+		return s3store.New(s, cfg.StoreConfig()), nil
+	default:
+		return nil, errors.New("unknown object store " + cfg.Kind)
+	}
 }
 
 // NewProfileRouter returns new router for profile endpoints
 func (h *profileHandler) NewProfileRouter() http.Handler {
 	r := chi.NewRouter()
+	if h.Tenants != nil {
+		r.Use(resolveTenant(h.Tenants))
+	}
 
-	r.Post("/", h.CreateProfile)
-	r.Delete("/{ProfileID}", h.DeleteProfile)
-	r.Put("/{ProfileID}", h.UpdateProfile)
-	r.Post("/_search", h.SearchProfile)
-	r.Put("/{ProfileID}/_upload", h.UploadProfileImage)
+	r.With(authorize(auth.CreateProfile)).Post("/", h.CreateProfile)
+	r.With(authorize(auth.ReadProfile)).Get("/{ProfileID}", h.GetProfile)
+	r.With(authorize(auth.WriteProfile)).Delete("/{ProfileID}", h.DeleteProfile)
+	r.With(authorize(auth.WriteProfile)).Put("/{ProfileID}", h.UpdateProfile)
+	r.With(authorize(auth.WriteProfile)).Post("/{ProfileID}/_restore", h.RestoreProfile)
+	r.With(authorize(auth.SearchProfile)).Post("/_search", h.SearchProfile)
+	r.With(authorize(auth.WriteProfile)).Put("/{ProfileID}/_upload", h.UploadProfileImage)
+	r.With(authorize(auth.WriteProfile)).Delete("/{ProfileID}/image", h.DeleteProfileImage)
+	r.With(authorize(auth.ReadHistory)).Get("/{ProfileID}/_history", h.ProfileHistory)
 
 	return r
 }
@@ -85,29 +174,36 @@ func (h *profileHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&createProfileRequest)
 
 	if err != nil {
-		e := entity.NewError("invalid create profile request " + err.Error())
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, invalidRequest(err))
 		return
 	}
 
-	tenant := r.Header.Get("ntenant")
-	if len(tenant) == 0 {
-		tenant = "default"
+	createProfileRequest.EmailID = validation.NormalizeEmail(createProfileRequest.EmailID)
+	createProfileRequest.Mobile = validation.NormalizeMobile(createProfileRequest.Mobile)
+
+	if err := validation.Struct(createProfileRequest); err != nil {
+		writeError(w, r, err)
+		return
 	}
 
+	tenant := tenantID(r)
+
 	p := mappers.ToProfile(createProfileRequest)
 	p.TenantID = tenant
 
-	id, err := h.ProfileService.Create(p)
+	// users create their own profile, it is keyed by their subject so that self policies match it
+	if principal, _ := auth.FromContext(r.Context()); !principal.HasScope(auth.ScopeAdmin) {
+		p.ProfileID = principal.Subject
+	}
+
+	id, err := h.ProfileService.Create(r.Context(), p)
 
 	if err != nil {
-		e := entity.NewError("error processing create profile request " + err.Error())
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(p.Version))
 	e := entity.CreateProfileResponse{ProfileID: id, TenantID: tenant}
 	res, _ := json.Marshal(e)
 	w.Write(res)
@@ -116,17 +212,30 @@ func (h *profileHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 func (h *profileHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "ProfileID")
 
-	tenant := r.Header.Get("ntenant")
-	if len(tenant) == 0 {
-		tenant = "default"
+	tenant := tenantID(r)
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	status, err := h.ProfileService.Delete(id, tenant)
+	var status bool
+
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+	if purge {
+		if !h.isAdmin(r) {
+			writeError(w, r, entity.NewDomainError(entity.KindForbidden, "admin_required", "purge is allowed only for admin"))
+			return
+		}
+
+		status, err = h.ProfileService.Purge(r.Context(), id, tenant)
+	} else {
+		status, err = h.ProfileService.Delete(r.Context(), id, tenant, version)
+	}
 
 	if err != nil {
-		e := entity.NewError("error processing delete profile request " + err.Error())
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, err)
 		return
 	}
 
@@ -135,6 +244,77 @@ func (h *profileHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
 	w.Write(res)
 }
 
+func (h *profileHandler) RestoreProfile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "ProfileID")
+
+	tenant := tenantID(r)
+
+	status, err := h.ProfileService.Restore(r.Context(), id, tenant)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	e := entity.SuccessResponse{Status: strconv.FormatBool(status)}
+	res, _ := json.Marshal(e)
+	w.Write(res)
+}
+
+// isAdmin reports whether the principal holds the admin scope or request carries the admin key
+func (h *profileHandler) isAdmin(r *http.Request) bool {
+	if p, ok := auth.FromContext(r.Context()); ok && p.HasScope(auth.ScopeAdmin) {
+		return true
+	}
+
+	key := r.Header.Get("X-Admin-Key")
+	return len(h.AdminKey) > 0 && subtle.ConstantTimeCompare([]byte(key), []byte(h.AdminKey)) == 1
+}
+
+func (h *profileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "ProfileID")
+
+	tenant := tenantID(r)
+
+	profile, err := h.ProfileService.Get(r.Context(), id, tenant)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(profile.Version))
+	res, _ := json.Marshal(profile)
+	w.Write(res)
+}
+
+// ProfileHistory serves the audit trail of the profile page by page, newest changes first.
+// The page size is given by limit and following pages by the next_cursor of the previous page.
+func (h *profileHandler) ProfileHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "ProfileID")
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, r, entity.NewDomainError(entity.KindValidation, "invalid_limit", "limit must be a positive number"))
+			return
+		}
+		limit = n
+	}
+
+	history, err := h.ProfileService.History(r.Context(), id, tenantID(r), limit, r.URL.Query().Get("cursor"))
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	history.Items = h.Masker.Mask(history.Items)
+	res, _ := json.Marshal(history)
+	w.Write(res)
+}
+
 func (h *profileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "ProfileID")
 
@@ -145,18 +325,30 @@ func (h *profileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&updateProfileRequest)
 
 	if err != nil {
-		e := entity.NewError("invalid update profile request " + err.Error())
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, invalidRequest(err))
 		return
 	}
 
-	tenant := r.Header.Get("ntenant")
-	if len(tenant) == 0 {
-		tenant = "default"
+	updateProfileRequest.EmailID = validation.NormalizeEmail(updateProfileRequest.EmailID)
+	updateProfileRequest.Mobile = validation.NormalizeMobile(updateProfileRequest.Mobile)
+
+	if err := validation.Struct(updateProfileRequest); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tenant := tenantID(r)
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
 	filter := map[string]interface{}{"profile_id": id, "tenant_id": tenant}
+	if version != 0 {
+		filter["version"] = version
+	}
 
 	fieldsToUpdate := map[string]interface{}{
 		"full_name":  updateProfileRequest.FullName,
@@ -168,15 +360,15 @@ func (h *profileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fieldsToUpdate = entity.RemoveEmptyValues(fieldsToUpdate)
-	status, err := h.ProfileService.Update(filter, fieldsToUpdate)
+	newVersion, err := h.ProfileService.Update(r.Context(), filter, fieldsToUpdate)
+
 	if err != nil {
-		e := entity.NewError("error processing update profile request")
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, err)
 		return
 	}
 
-	e := entity.SuccessResponse{Status: strconv.FormatBool(status)}
+	w.Header().Set("ETag", etag(newVersion))
+	e := entity.SuccessResponse{Status: strconv.FormatBool(newVersion > 0)}
 	res, _ := json.Marshal(e)
 	w.Write(res)
 }
@@ -189,80 +381,147 @@ func (h *profileHandler) SearchProfile(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&searchProfileRequest)
 
 	if err != nil {
-		e := entity.NewError("invalid search profile request " + err.Error())
-		res, _ := json.Marshal(e)
-		w.Write(res)
+		writeError(w, r, invalidRequest(err))
 		return
 	}
 
-	tenant := r.Header.Get("ntenant")
-	if len(tenant) == 0 {
-		tenant = "default"
+	tenant := tenantID(r)
+
+	if len(searchProfileRequest.Query) > 0 {
+		writeError(w, r, entity.NewDomainError(entity.KindValidation, "query_not_supported", "query is no longer supported, use filter instead"))
+		return
 	}
 
-	query := searchProfileRequest.Query
-	sortBy := searchProfileRequest.SortBy
-	profiles, err := h.ProfileService.Search(query,
-		int(searchProfileRequest.Limit),
-		int(searchProfileRequest.Offset),
-		sortBy,
-		tenant)
+	page, err := h.ProfileService.Search(r.Context(), searchProfileRequest, tenant)
 
 	if err != nil {
-		e := entity.NewError("Error processing search profile request. " + err.Error())
-		res, _ := json.Marshal(e)
+		writeError(w, r, err)
+		return
+	}
+
+	// offset paging keeps returning a plain list for older clients
+	if !searchProfileRequest.CursorMode() {
+		res, _ := json.Marshal(page.Items)
 		w.Write(res)
 		return
 	}
 
-	res, _ := json.Marshal(profiles)
+	res, _ := json.Marshal(page)
 	w.Write(res)
 }
 
 func (h *profileHandler) UploadProfileImage(w http.ResponseWriter, r *http.Request) {
-	// allow only 2MB of file size
-	err := r.ParseMultipartForm(maxUploadFileSize)
+	maxSize := h.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxUploadSize
+	}
+	tooLarge := "image too large, max file size allowed is " + strconv.FormatInt(maxSize, 10) + " bytes"
+
+	// leave room for the multipart envelope
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+maxMultipartOverhead)
+	err := r.ParseMultipartForm(maxSize)
 	if err != nil {
-		res, _ := entity.NewErrorJSON("Image too large, max file size allowed is 2MB. " + err.Error())
-		w.Write(res)
+		writeError(w, r, entity.WrapError(entity.KindTooLarge, "image_too_large", tooLarge, err))
 		return
 	}
 
 	file, fileHeader, err := r.FormFile("profile_image")
 	if err != nil {
-		res, _ := entity.NewErrorJSON("Error fetching uploaded file. " + err.Error())
-		w.Write(res)
+		writeError(w, r, entity.WrapError(entity.KindValidation, "profile_image_missing", "error fetching uploaded file", err))
 		return
 	}
 	defer file.Close()
 
-	fileName, err := s3store.UploadFileToS3(h.AWSSession, file, fileHeader)
-	if err != nil {
-		res, _ := entity.NewErrorJSON("Unable to upload file. " + err.Error())
-		w.Write(res)
+	if fileHeader.Size > maxSize {
+		writeError(w, r, entity.NewDomainError(entity.KindTooLarge, "image_too_large", tooLarge))
 		return
 	}
 
-	profileImageURL := s3ImagePrefix + fileName
+	data, err := ioutil.ReadAll(file)
+	if err == nil && int64(len(data)) != fileHeader.Size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		writeError(w, r, entity.WrapError(entity.KindValidation, "invalid_upload", "error reading uploaded file", err))
+		return
+	}
 
-	// update profile in database with image url
+	// store image renditions and update profile in database with image url
 	id := chi.URLParam(r, "ProfileID")
-	tenant := r.Header.Get("ntenant")
-	if len(tenant) == 0 {
-		tenant = "default"
+	tenant := tenantID(r)
+
+	uploadSize.WithLabelValues(metrics.Tenant(tenant)).Observe(float64(len(data)))
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	filter := map[string]interface{}{"profile_id": id, "tenant_id": tenant}
-	fieldsToUpdate := map[string]interface{}{"profile_image_url": profileImageURL}
-	_, err = h.ProfileService.Update(filter, fieldsToUpdate)
+	renditions, newVersion, err := h.ProfileService.UploadProfileImage(r.Context(), id, tenant, data, version)
+
 	if err != nil {
-		res, _ := entity.NewErrorJSON("Unable to update profile with image url. " + err.Error())
-		w.Write(res)
+		writeError(w, r, err)
 		return
 	}
 
+	profileImageURL := renditions.Largest()
+	w.Header().Set("ETag", etag(newVersion))
+
 	// prepare response object and return
 	e := entity.SuccessResponse{Status: "File upload successful. File uploaded at " + profileImageURL}
 	res, _ := json.Marshal(e)
 	w.Write(res)
 }
+
+func (h *profileHandler) DeleteProfileImage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "ProfileID")
+
+	tenant := tenantID(r)
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	newVersion, err := h.ProfileService.DeleteProfileImage(r.Context(), id, tenant, version)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(newVersion))
+
+	e := entity.SuccessResponse{Status: "true"}
+	res, _ := json.Marshal(e)
+	w.Write(res)
+}
+
+// etag returns ETag header value of the profile version
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion returns profile version required by If-Match header, zero when any version is accepted
+func ifMatchVersion(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(value) == 0 || value == "*" {
+		return 0, nil
+	}
+
+	// versions are compared exactly, so weak tags are treated as strong ones
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, entity.NewDomainError(entity.KindPreconditionFailed, "invalid_if_match", "If-Match must be a single quoted etag")
+	}
+
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, entity.NewDomainError(entity.KindPreconditionFailed, "invalid_if_match", "If-Match etag "+value+" is not a profile version")
+	}
+
+	return version, nil
+}
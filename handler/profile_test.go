@@ -1,24 +1,40 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"n_users/audit"
+	"n_users/auth"
+	"n_users/config"
 	"n_users/controller"
 	"n_users/entity"
+	"n_users/gateway/memstore"
+	"n_users/gateway/objectstore"
 	"n_users/mocks"
+	"n_users/repo"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func GetCreateProfileRequest() *http.Request {
 	data := entity.CreateProfileRequest{
-		FullName: "Nimesh",
-		EmailID:  "nimesh@gmail.com",
-		Mobile:   "8888800000",
+		FullName:  "Nimesh",
+		EmailID:   "nimesh@gmail.com",
+		Mobile:    "+918888800000",
+		BirthDate: time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC),
+		CityID:    "bangalore",
+		CountryID: "india",
 	}
 	b, _ := json.Marshal(data)
 	payload := strings.NewReader(string(b))
@@ -36,15 +52,15 @@ func GetMockCreateProfileHandler(t *testing.T, triggerError bool) ProfileHandler
 		err = errors.New("error")
 	}
 
-	mockProfileRepo.EXPECT().Create(gomock.Any()).Return("101", err).Times(1)
+	mockProfileRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return("101", err).Times(1)
 
-	return &profileHandler{ProfileService: controller.New(mockProfileRepo)}
+	return &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
 }
 
 func TestCreateProfile(t *testing.T) {
 	w := httptest.NewRecorder()
 
-	GetMockCreateProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, GetCreateProfileRequest())
+	GetMockCreateProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, asAdmin(GetCreateProfileRequest()))
 	resp := w.Result()
 
 	if resp.StatusCode != http.StatusOK {
@@ -61,6 +77,74 @@ func TestCreateProfile(t *testing.T) {
 	}
 }
 
+func TestCreateProfileValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+
+	body := `{"full_name":"Nimesh","email_id":"nimesh@","mobile":"8888800000","gender":"robot","birth_date":"2990-01-01T00:00:00Z","city_id":"bangalore"}`
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8085/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("create invalid profile didn’t respond 400: %s", w.Result().Status)
+	}
+
+	var p entity.Problem
+	if err := json.NewDecoder(w.Result().Body).Decode(&p); err != nil || p.Code != "validation_failed" {
+		t.Fatalf("create invalid profile problem is %+v, %v but expected validation_failed", p, err)
+	}
+
+	codes := map[string]string{}
+	for _, f := range p.Errors {
+		codes[f.Field] = f.Code
+	}
+
+	expected := map[string]string{
+		"gender":     "oneof",
+		"email_id":   "email",
+		"mobile":     "e164",
+		"birth_date": "birthdate",
+		"country_id": "required",
+	}
+	if len(codes) != len(expected) {
+		t.Errorf("create invalid profile field errors are %v but expected %v", codes, expected)
+	}
+	for field, code := range expected {
+		if codes[field] != code {
+			t.Errorf("field %s error is %q but expected %q", field, codes[field], code)
+		}
+	}
+}
+
+func TestCreateProfileNormalizesContacts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	var created entity.Profile
+	mockProfileRepo.EXPECT().Create(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, p entity.Profile) (string, error) {
+			created = p
+			return p.ProfileID, nil
+		}).Times(1)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+
+	body := `{"full_name":"Nimesh","email_id":" Nimesh@Gmail.COM ","mobile":"+91 88888-00000","birth_date":"1990-05-17T00:00:00Z","city_id":"bangalore","country_id":"india"}`
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8085/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("create profile didn’t respond 200 OK: %s", w.Result().Status)
+	}
+
+	if created.EmailID != "nimesh@gmail.com" || created.Mobile != "+918888800000" {
+		t.Errorf("created profile has email %q and mobile %q but expected normalized values", created.EmailID, created.Mobile)
+	}
+}
+
 func GetDeleteProfileRequest() *http.Request {
 	req, _ := http.NewRequest(http.MethodDelete, "http://localhost:8085/201", nil)
 	return req
@@ -76,15 +160,15 @@ func GetMockDeleteProfileHandler(t *testing.T, triggerError bool) ProfileHandler
 		err = errors.New("error")
 	}
 
-	mockProfileRepo.EXPECT().Delete("201", gomock.Any()).Return(true, err).Times(1)
+	mockProfileRepo.EXPECT().Delete(gomock.Any(), "201", gomock.Any(), int64(0)).Return(true, err).Times(1)
 
-	return &profileHandler{ProfileService: controller.New(mockProfileRepo)}
+	return &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
 }
 
 func TestDeleteProfile(t *testing.T) {
 	w := httptest.NewRecorder()
 
-	GetMockDeleteProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, GetDeleteProfileRequest())
+	GetMockDeleteProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, asAdmin(GetDeleteProfileRequest()))
 	resp := w.Result()
 
 	if resp.StatusCode != http.StatusOK {
@@ -101,11 +185,190 @@ func TestDeleteProfile(t *testing.T) {
 	}
 }
 
+func GetGetProfileRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/401", nil)
+	return req
+}
+
+func GetMockGetProfileHandler(t *testing.T, err error) ProfileHandler {
+	mockCtrl := gomock.NewController(t)
+
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	profile := entity.Profile{ProfileID: "401", TenantID: "default", FullName: "Nimesh", Version: 7}
+	if err != nil {
+		profile = entity.Profile{}
+	}
+
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "401", "default").Return(profile, err).Times(1)
+
+	return &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+}
+
+func TestGetProfile(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	GetMockGetProfileHandler(t, nil).NewProfileRouter().ServeHTTP(w, asAdmin(GetGetProfileRequest()))
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("get profile didn’t respond 200 OK: %s", resp.Status)
+	}
+
+	var p entity.Profile
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Errorf("get profile response parsing error %s", err)
+	}
+
+	if p.ProfileID != "401" {
+		t.Errorf("get profile response id is %s but expected 401", p.ProfileID)
+	}
+
+	if tag := resp.Header.Get("ETag"); tag != `"7"` {
+		t.Errorf("get profile etag is %s but expected \"7\"", tag)
+	}
+}
+
+func TestGetProfileNotFound(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	GetMockGetProfileHandler(t, repo.ErrNotFound).NewProfileRouter().ServeHTTP(w, asAdmin(GetGetProfileRequest()))
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get profile didn’t respond 404 Not Found: %s", resp.Status)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("get profile error content type is %s but expected application/problem+json", ct)
+	}
+
+	var p entity.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil || p.Code != "profile_not_found" || p.Status != http.StatusNotFound {
+		t.Errorf("get profile problem is %+v, %v but expected profile_not_found", p, err)
+	}
+}
+
+func TestProblemCarriesTraceID(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true})
+
+	req := GetGetProfileRequest()
+	req = req.WithContext(trace.ContextWithSpanContext(req.Context(), sc))
+
+	w := httptest.NewRecorder()
+	GetMockGetProfileHandler(t, repo.ErrNotFound).NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	var p entity.Problem
+	if err := json.NewDecoder(w.Result().Body).Decode(&p); err != nil || p.TraceID != traceID.String() {
+		t.Errorf("problem is %+v, %v but expected trace id %s", p, err, traceID)
+	}
+}
+
+func TestCreateProfileErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	GetMockCreateProfileHandler(t, true).NewProfileRouter().ServeHTTP(w, asAdmin(GetCreateProfileRequest()))
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("create profile with failing repo didn’t respond 500: %s", resp.Status)
+	}
+
+	var p entity.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil || p.Code != "internal" || strings.Contains(p.Detail, "error:") {
+		t.Errorf("create profile problem is %+v, %v but expected internal error without cause", p, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8085/", strings.NewReader("{"))
+	w = httptest.NewRecorder()
+	(&profileHandler{}).NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("create profile with malformed body didn’t respond 400: %s", w.Result().Status)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Create(gomock.Any(), gomock.Any()).
+		Return("", entity.NewDomainError(entity.KindConflict, "duplicate_profile", "profile already exists")).Times(1)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(GetCreateProfileRequest()))
+
+	if w.Result().StatusCode != http.StatusConflict {
+		t.Errorf("create duplicate profile didn’t respond 409: %s", w.Result().Status)
+	}
+}
+
+func TestProfileRequestTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	GetMockCreateProfileHandler(t, true).NewProfileRouter().ServeHTTP(w, asAdmin(GetCreateProfileRequest().WithContext(ctx)))
+
+	var p entity.Problem
+	if err := json.NewDecoder(w.Result().Body).Decode(&p); err != nil || w.Code != http.StatusGatewayTimeout || p.Code != "request_timeout" {
+		t.Errorf("request past its deadline answered %d %+v but expected 504 request_timeout", w.Code, p)
+	}
+}
+
+func TestPurgeProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Purge(gomock.Any(), "201", "default").Return(entity.Profile{ProfileID: "201"}, nil).Times(1)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{})), AdminKey: "secret"}
+
+	// the owner may delete but not purge the profile
+	owner := auth.Principal{Subject: "201", Scopes: []string{auth.ScopeWrite}}
+
+	// purge without admin key is rejected
+	req, _ := http.NewRequest(http.MethodDelete, "http://localhost:8085/201?purge=true", nil)
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, as(req, owner))
+
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Errorf("purge without admin key didn’t respond 403 Forbidden: %s", w.Result().Status)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, "http://localhost:8085/201?purge=true", nil)
+	req.Header.Set("X-Admin-Key", "secret")
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, as(req, owner))
+
+	var sr entity.SuccessResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&sr); err != nil || sr.Status != "true" {
+		t.Errorf("purge profile status is %s, %v but expected true", sr.Status, err)
+	}
+}
+
+func TestRestoreProfile(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().Restore(gomock.Any(), "201", "default").Return(true, nil).Times(1)
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "201", "default").Return(entity.Profile{ProfileID: "201"}, nil)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8085/201/_restore", nil)
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	var sr entity.SuccessResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&sr); err != nil || sr.Status != "true" {
+		t.Errorf("restore profile status is %s, %v but expected true", sr.Status, err)
+	}
+}
+
 func GetUpdateProfileRequest() *http.Request {
 	data := entity.UpdateProfileRequest{
 		FullName: "Nimesh",
 		EmailID:  "nimesh@gmail.com",
-		Mobile:   "8888800000",
+		Mobile:   "+918888800000",
 	}
 	b, _ := json.Marshal(data)
 	payload := strings.NewReader(string(b))
@@ -123,15 +386,15 @@ func GetMockUpdateProfileHandler(t *testing.T, triggerError bool) ProfileHandler
 		err = errors.New("error")
 	}
 
-	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(true, err).Times(1)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(2), err).Times(1)
 
-	return &profileHandler{ProfileService: controller.New(mockProfileRepo)}
+	return &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
 }
 
 func TestUpdateProfile(t *testing.T) {
 	w := httptest.NewRecorder()
 
-	GetMockUpdateProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, GetUpdateProfileRequest())
+	GetMockUpdateProfileHandler(t, false).NewProfileRouter().ServeHTTP(w, asAdmin(GetUpdateProfileRequest()))
 	resp := w.Result()
 
 	if resp.StatusCode != http.StatusOK {
@@ -147,3 +410,210 @@ func TestUpdateProfile(t *testing.T) {
 		t.Errorf("update profile status is %s but expected true", sr.Status)
 	}
 }
+
+func GetUploadProfileImageRequest() *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("profile_image", "me.png")
+	png.Encode(part, image.NewNRGBA(image.Rect(0, 0, 300, 200)))
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, "http://localhost:8085/501/_upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUpdateProfileIfMatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	var filters map[string]interface{}
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, f map[string]interface{}, fields map[string]interface{}) (int64, error) {
+			filters = f
+			return 4, nil
+		}).Times(1)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0), repo.ErrVersionMismatch).Times(1)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{}))}
+
+	req := GetUpdateProfileRequest()
+	req.Header.Set("If-Match", `"3"`)
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if filters["version"] != int64(3) {
+		t.Errorf("update filters are %v but expected version 3", filters)
+	}
+
+	if tag := w.Result().Header.Get("ETag"); tag != `"4"` {
+		t.Errorf("update profile etag is %s but expected \"4\"", tag)
+	}
+
+	req = GetUpdateProfileRequest()
+	req.Header.Set("If-Match", `"3"`)
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("update with stale version didn’t respond 412: %s", w.Result().Status)
+	}
+
+	req = GetUpdateProfileRequest()
+	req.Header.Set("If-Match", `abc`)
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("update with malformed etag didn’t respond 412: %s", w.Result().Status)
+	}
+}
+
+func TestUploadProfileImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	var renditions entity.ImageRenditions
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "501", "default").Return(entity.Profile{ProfileID: "501"}, nil).Times(1)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, filters map[string]interface{}, fields map[string]interface{}) (int64, error) {
+			renditions = fields["profile_image_renditions"].(entity.ImageRenditions)
+			return 2, nil
+		}).Times(1)
+
+	store := memstore.New(objectstore.Config{KeyPrefix: "images/", PublicURLBase: "http://cdn.local"})
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, store)}
+
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(GetUploadProfileImageRequest()))
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("upload profile image didn’t respond 200 OK: %s", w.Result().Status)
+	}
+
+	objects := store.Objects()
+	if len(objects) != 3 || len(renditions) != 3 {
+		t.Fatalf("upload stored %d objects and %d renditions but expected 3", len(objects), len(renditions))
+	}
+
+	for size, url := range renditions {
+		key := strings.TrimPrefix(url, "http://cdn.local/")
+		o, ok := objects[key]
+		if !ok || !strings.HasSuffix(key, "_"+size+".png") {
+			t.Errorf("rendition %s url %s does not point to a stored object", size, url)
+		}
+
+		if o.ContentType != "image/png" {
+			t.Errorf("stored content type is %s but expected image/png", o.ContentType)
+		}
+	}
+}
+
+func TestUploadProfileImageRejectsNonImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, store)}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("profile_image", "me.png")
+	part.Write([]byte("not an image"))
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, "http://localhost:8085/501/_upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Result().StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("upload of non image didn’t respond 415: %s", w.Result().Status)
+	}
+
+	if len(store.Objects()) != 0 {
+		t.Errorf("non image upload stored objects")
+	}
+}
+
+func TestDeleteProfileImage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+
+	store := memstore.New(objectstore.Config{})
+	store.Put(context.Background(), "old_64.png", strings.NewReader("image"), 5, "image/png")
+	store.Put(context.Background(), "other_64.png", strings.NewReader("image"), 5, "image/png")
+
+	mockProfileRepo.EXPECT().Get(gomock.Any(), "601", "default").Return(entity.Profile{ProfileID: "601", ProfileImageKey: "old"}, nil).Times(1)
+	mockProfileRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(2), nil).Times(1)
+
+	h := &profileHandler{ProfileService: controller.New(mockProfileRepo, store)}
+
+	req, _ := http.NewRequest(http.MethodDelete, "http://localhost:8085/601/image", nil)
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	var sr entity.SuccessResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&sr); err != nil || sr.Status != "true" || w.Header().Get("ETag") != `"2"` {
+		t.Errorf("delete profile image status is %s, %v with ETag %s but expected true and version 2", sr.Status, err, w.Header().Get("ETag"))
+	}
+
+	objects := store.Objects()
+	if _, ok := objects["old_64.png"]; ok || len(objects) != 1 {
+		t.Errorf("delete profile image left objects %v", objects)
+	}
+}
+
+func TestProfileHistory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockProfileRepo := mocks.NewMockProfileRepo(mockCtrl)
+	mockProfileRepo.EXPECT().History(gomock.Any(), "201", "default", 1, "").Return(entity.ProfileHistory{
+		Items: []entity.AuditEntry{{
+			AuditID: 9, ProfileID: "201", Action: entity.AuditUpdate, Actor: "admin", Version: 4,
+			Changes: entity.FieldChanges{
+				"email_id":  {Before: "nimesh@example.com", After: "n.k@example.com"},
+				"full_name": {Before: "Nimesh", After: "Nimesh K"},
+			},
+		}},
+		NextCursor: "next",
+	}, nil).Times(1)
+	mockProfileRepo.EXPECT().History(gomock.Any(), "202", "default", 0, "").Return(entity.ProfileHistory{}, nil).Times(1)
+
+	h := &profileHandler{
+		ProfileService: controller.New(mockProfileRepo, memstore.New(objectstore.Config{})),
+		Masker:         audit.NewMasker(config.AuditConfig{MaskedFields: []string{"email_id"}, Mask: "partial"}),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:8085/201/_history?limit=1", nil)
+	w := httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	var history entity.ProfileHistory
+	if err := json.NewDecoder(w.Result().Body).Decode(&history); err != nil || w.Code != http.StatusOK || len(history.Items) != 1 || history.NextCursor != "next" {
+		t.Fatalf("history answered %d %+v, %v", w.Code, history, err)
+	}
+
+	changes := history.Items[0].Changes
+	if changes["email_id"].Before != "n***@example.com" || changes["full_name"].After != "Nimesh K" {
+		t.Errorf("history changes %v are not masked as configured", changes)
+	}
+
+	// profiles without history are not found
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost:8085/202/_history", nil)
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("history of unknown profile answered %d", w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost:8085/201/_history?limit=-1", nil)
+	w = httptest.NewRecorder()
+	h.NewProfileRouter().ServeHTTP(w, asAdmin(req))
+
+	var p entity.Problem
+	if json.NewDecoder(w.Body).Decode(&p); w.Code != http.StatusBadRequest || p.Code != "invalid_limit" {
+		t.Errorf("history with negative limit answered %d %+v", w.Code, p)
+	}
+}
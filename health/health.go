@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// CheckFunc reports health of a dependency, it returns error when the dependency is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of the latest run of a check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	// LastError is kept after the dependency recovers, it helps to explain flapping checks
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// Report is the outcome of all checks. Status is down when a critical check failed and
+// degraded when only non critical checks failed.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed, degraded dependencies do not stop serving
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+type check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Fn       CheckFunc
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt *time.Time
+}
+
+// Checker is a registry of dependency checks
+type Checker struct {
+	mu     sync.RWMutex
+	checks []*check
+
+	// CacheTTL is how long a report is served before checks run again, probes of every replica
+	// would otherwise each hit the database and object store
+	CacheTTL time.Duration
+
+	runMu     sync.Mutex
+	report    Report
+	checkedAt time.Time
+}
+
+// NewChecker creates new object of Checker serving reports up to cacheTTL old, zero runs checks on every call
+func NewChecker(cacheTTL time.Duration) *Checker {
+	return &Checker{CacheTTL: cacheTTL}
+}
+
+// Register adds a check of a dependency. The check fails when fn does not return within
+// timeout, a failed critical check makes the service not ready.
+func (c *Checker) Register(name string, critical bool, timeout time.Duration, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, &check{Name: name, Critical: critical, Timeout: timeout, Fn: fn})
+
+	c.runMu.Lock()
+	c.checkedAt = time.Time{}
+	c.runMu.Unlock()
+}
+
+// Run returns the report of the latest run when it is younger than CacheTTL, otherwise it runs every
+// check concurrently. Concurrent callers share one run. Results are in order of registration.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	if c.CacheTTL > 0 && !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.CacheTTL {
+		return c.report
+	}
+
+	report := c.run(ctx)
+
+	// checks cut short by a caller that went away say nothing about the dependencies
+	if ctx.Err() == nil {
+		c.report, c.checkedAt = report, time.Now()
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch *check) {
+			defer wg.Done()
+			results[i] = ch.run(ctx)
+		}(i, ch)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, r := range results {
+		if r.Status == StatusUp {
+			continue
+		}
+
+		if r.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func (ch *check) run(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, ch.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+
+	// a check ignoring ctx must not hold the probe past its timeout
+	go func() { done <- ch.Fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	now := time.Now()
+	r := Result{
+		Name:      ch.Name,
+		Status:    StatusUp,
+		Critical:  ch.Critical,
+		LatencyMS: float64(now.Sub(start).Microseconds()) / 1000,
+		CheckedAt: now,
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if err != nil {
+		r.Status = StatusDown
+		ch.lastError = err.Error()
+		ch.lastErrorAt = &now
+	}
+
+	r.LastError = ch.lastError
+	r.LastErrorAt = ch.lastErrorAt
+	return r
+}
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	failing := true
+
+	c := NewChecker(0)
+	c.Register("postgres", true, time.Second, func(ctx context.Context) error {
+		if failing {
+			return dbErr
+		}
+		return nil
+	})
+	c.Register("object_store", false, 20*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	report := c.Run(context.Background())
+	if report.Status != StatusDown || len(report.Checks) != 2 {
+		t.Fatalf("report is %+v but expected down with 2 checks", report)
+	}
+
+	if r := report.Checks[0]; r.Name != "postgres" || r.Status != StatusDown || r.LastError != dbErr.Error() {
+		t.Errorf("postgres result is %+v", r)
+	}
+
+	if r := report.Checks[1]; r.Status != StatusDown || r.LatencyMS > 500 {
+		t.Errorf("slow object store result is %+v but expected timeout", r)
+	}
+
+	failing = false
+	c.checks = c.checks[:1]
+	report = c.Run(context.Background())
+
+	if r := report.Checks[0]; report.Status != StatusUp || r.Status != StatusUp || r.LastError != dbErr.Error() || r.LastErrorAt == nil {
+		t.Errorf("recovered report is %+v but expected up with last error kept", report)
+	}
+}
+
+func TestCheckerDegraded(t *testing.T) {
+	c := NewChecker(0)
+	c.Register("postgres", true, time.Second, func(ctx context.Context) error { return nil })
+	c.Register("object_store", false, time.Second, func(ctx context.Context) error { return errors.New("bucket missing") })
+
+	if report := c.Run(context.Background()); report.Status != StatusDegraded {
+		t.Errorf("report status is %s but expected degraded", report.Status)
+	}
+}
+
+func TestCheckerCachesReport(t *testing.T) {
+	var mu sync.Mutex
+	runs := 0
+
+	c := NewChecker(time.Hour)
+	c.Register("object_store", false, time.Second, func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Run(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	ran := runs
+	mu.Unlock()
+
+	if ran != 1 {
+		t.Errorf("concurrent probes ran the check %d times but expected once", ran)
+	}
+
+	// a cancelled probe does not replace the cached report
+	c.Register("postgres", true, time.Second, func(ctx context.Context) error { return ctx.Err() })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if report := c.Run(ctx); report.Status != StatusDown {
+		t.Errorf("report of cancelled probe is %s but expected down", report.Status)
+	}
+
+	if report := c.Run(context.Background()); report.Status != StatusUp || len(report.Checks) != 2 {
+		t.Errorf("report after cancelled probe is %+v but expected both checks up", report)
+	}
+}
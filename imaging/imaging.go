@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	// register webp decoder
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+const jpegQuality = 85
+
+// Error is returned when uploaded data is not an acceptable image
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "invalid image: " + e.Reason
+}
+
+// Options controls accepted images and produced renditions
+type Options struct {
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+	// Sizes lists the longest side in pixels of every rendition, in ascending order
+	Sizes []int
+}
+
+// DefaultOptions accepts images between 64x64 and 8000x8000 pixels and produces 64, 256 and 1024px renditions
+var DefaultOptions = Options{
+	MinWidth:  64,
+	MinHeight: 64,
+	MaxWidth:  8000,
+	MaxHeight: 8000,
+	Sizes:     []int{64, 256, 1024},
+}
+
+// Rendition represents a resized and re-encoded variant of an uploaded image
+type Rendition struct {
+	Size        int
+	Width       int
+	Height      int
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Process validates the image and produces one rendition per configured size.
+//
+// Only JPEG, PNG and WebP are accepted. Dimensions are checked from the header before
+// the image is decoded, so oversized images are rejected without allocating pixels.
+// Renditions are encoded from pixels only, which drops EXIF, GPS and any other metadata.
+// JPEG orientation is applied to the pixels before the metadata is dropped.
+func Process(data []byte, opts Options) ([]Rendition, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &Error{Reason: "unsupported image format, allowed formats are jpeg, png and webp"}
+	}
+
+	if format != "jpeg" && format != "png" && format != "webp" {
+		return nil, &Error{Reason: fmt.Sprintf("unsupported image format %s, allowed formats are jpeg, png and webp", format)}
+	}
+
+	if cfg.Width < opts.MinWidth || cfg.Height < opts.MinHeight {
+		return nil, &Error{Reason: fmt.Sprintf("image is %dx%d, minimum allowed is %dx%d", cfg.Width, cfg.Height, opts.MinWidth, opts.MinHeight)}
+	}
+
+	if cfg.Width > opts.MaxWidth || cfg.Height > opts.MaxHeight {
+		return nil, &Error{Reason: fmt.Sprintf("image is %dx%d, maximum allowed is %dx%d", cfg.Width, cfg.Height, opts.MaxWidth, opts.MaxHeight)}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &Error{Reason: "image data is corrupt or truncated"}
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	renditions := make([]Rendition, 0, len(opts.Sizes))
+	for _, size := range opts.Sizes {
+		img := orient(resize(src, size), orientation)
+
+		r, err := encode(img, format)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Size = size
+		renditions = append(renditions, r)
+	}
+
+	return renditions, nil
+}
+
+// resize scales image so that its longest side is at most size, smaller images are not enlarged
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w <= size && h <= size {
+		dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+// encode writes JPEG images back as JPEG, and PNG or WebP as PNG to keep transparency
+func encode(img image.Image, format string) (Rendition, error) {
+	var buf bytes.Buffer
+
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Rendition{}, err
+		}
+		return Rendition{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg",
+			Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}, nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return Rendition{}, err
+	}
+	return Rendition{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png",
+		Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}, nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,142 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0, A: 255})
+		}
+	}
+	return img
+}
+
+func TestProcessPNG(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(2000, 500))
+
+	renditions, err := Process(buf.Bytes(), DefaultOptions)
+	if err != nil {
+		t.Fatalf("process error %s", err)
+	}
+
+	expected := [][2]int{{64, 16}, {256, 64}, {1024, 256}}
+	for i, r := range renditions {
+		if r.Width != expected[i][0] || r.Height != expected[i][1] || r.ContentType != "image/png" {
+			t.Errorf("rendition %d is %dx%d %s but expected %v image/png", r.Size, r.Width, r.Height, r.ContentType, expected[i])
+		}
+	}
+}
+
+func TestProcessDoesNotEnlarge(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(100, 80), nil)
+
+	renditions, err := Process(buf.Bytes(), DefaultOptions)
+	if err != nil {
+		t.Fatalf("process error %s", err)
+	}
+
+	last := renditions[len(renditions)-1]
+	if last.Width != 100 || last.Height != 80 || last.ContentType != "image/jpeg" {
+		t.Errorf("largest rendition is %dx%d %s but expected 100x80 image/jpeg", last.Width, last.Height, last.ContentType)
+	}
+}
+
+func TestProcessRejectsInvalidImages(t *testing.T) {
+	var small, huge, gifImage bytes.Buffer
+	png.Encode(&small, testImage(10, 10))
+	gif.Encode(&gifImage, testImage(100, 100), nil)
+
+	// only the header is decoded for dimension checks, so a huge header is enough
+	png.Encode(&huge, testImage(1, 1))
+	hugeData := huge.Bytes()
+	binary.BigEndian.PutUint32(hugeData[16:20], 9000)
+
+	cases := map[string][]byte{
+		"small":     small.Bytes(),
+		"huge":      hugeData,
+		"gif":       gifImage.Bytes(),
+		"text":      []byte("not an image"),
+		"truncated": small.Bytes()[:40],
+	}
+
+	for name, data := range cases {
+		_, err := Process(data, DefaultOptions)
+
+		var imageErr *Error
+		if !errors.As(err, &imageErr) {
+			t.Errorf("%s image processed without validation error, %v", name, err)
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(200, 100), nil)
+	data := withOrientation(buf.Bytes(), 6)
+
+	if o := jpegOrientation(data); o != 6 {
+		t.Fatalf("orientation is %d but expected 6", o)
+	}
+
+	renditions, err := Process(data, Options{MinWidth: 1, MinHeight: 1, MaxWidth: 1000, MaxHeight: 1000, Sizes: []int{64}})
+	if err != nil {
+		t.Fatalf("process error %s", err)
+	}
+
+	if r := renditions[0]; r.Width != 32 || r.Height != 64 {
+		t.Errorf("rotated rendition is %dx%d but expected 32x64", r.Width, r.Height)
+	}
+
+	if bytes.Contains(renditions[0].Data, []byte("Exif")) {
+		t.Errorf("rendition still contains exif metadata")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	marker := color.NRGBA{R: 255, A: 255}
+	// bottom left pixel ends up top left after rotating clockwise
+	src.Set(0, 1, marker)
+
+	dst := orient(src, 6)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 3 {
+		t.Fatalf("rotated image is %v", dst.Bounds())
+	}
+
+	if dst.At(0, 0) != marker {
+		t.Errorf("rotated pixel is %v but expected %v", dst.At(0, 0), marker)
+	}
+}
+
+// withOrientation inserts an EXIF segment with the orientation tag after SOI marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1}
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns EXIF orientation (1 to 8) of a JPEG image, 1 when missing or unreadable
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+
+		// start of scan, no more metadata segments follow
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:entry+2]) == exifOrientationTag {
+			o := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+
+	return 1
+}
+
+// orient transforms image pixels so that it displays upright without the EXIF orientation tag
+func orient(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -1,8 +1,19 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"n_users/auth"
+	"n_users/config"
 	"n_users/handler"
+	"n_users/health"
+	"n_users/metrics"
 	"n_users/server"
+	"n_users/tracing"
 
 	"go.uber.org/zap"
 )
@@ -14,14 +25,68 @@ func initLogger() {
 
 func main() {
 	initLogger()
+	defer zap.L().Sync()
+
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		zap.L().Fatal("error loading config", zap.Error(err))
+	}
+
+	// secrets are redacted when config is marshalled
+	zap.L().Info("loaded config", zap.Any("config", cfg))
+
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(cfg.Database, args[1:]))
+	}
+
+	if len(args) > 0 && args[0] == "tenants" {
+		os.Exit(runTenants(cfg.Database, args[1:]))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	metrics.LimitTenants(cfg.Metrics.MaxTenants)
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		zap.L().Fatal("error setting up tracing", zap.Error(err))
+	}
+
+	authCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	authn, err := auth.New(authCtx, cfg.Auth)
+	cancel()
+	if err != nil {
+		zap.L().Fatal("error loading token verification keys", zap.Error(err))
+	}
+
+	s := server.New(cfg.Server)
+
+	stopMetrics, err := server.ServeMetrics(cfg.Metrics.Address)
+	if err != nil {
+		zap.L().Fatal("error serving metrics", zap.Error(err))
+	}
+	s.OnClose("metrics", stopMetrics)
+
+	// closers run in reverse order, tracing closes after the resources registered below so that spans
+	// of their shutdown are flushed, and before metrics registered above
+	s.OnClose("tracing", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		return shutdownTracing(ctx)
+	})
 
-	s := server.New()
+	checker := health.NewChecker(cfg.Health.CacheTTL)
 
-	hh := handler.NewHealthHandler()
+	hh := handler.NewHealthHandler(checker)
 	s.Mount("/", hh.NewHealthRouter())
+	s.OnDrain(hh.Drain)
 
-	ph := handler.NewProfileHandler()
-	s.Mount("/profiles", ph.NewProfileRouter())
+	ph := handler.NewProfileHandler(cfg, checker)
+	s.Mount("/profiles", handler.Authenticate(authn)(ph.NewProfileRouter()))
+	s.OnClose("profile handler", ph.Close)
 
-	s.StartServer(":8085")
+	if err := s.StartServer(ctx, cfg.Server.Address); err != nil {
+		zap.L().Fatal("server failed", zap.Error(err))
+	}
 }
@@ -22,7 +22,7 @@ func ToProfile(i entity.CreateProfileRequest) entity.Profile {
 	p.Longitude = i.Longitude
 
 	p.Active = true
-	p.TenantID = "default"
+	p.Version = 1
 	p.ProfileID = uuid.New().String()
 
 	return p
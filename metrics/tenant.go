@@ -0,0 +1,59 @@
+// Package metrics keeps the tenant label of Prometheus metrics from multiplying series
+package metrics
+
+import "sync"
+
+// OtherTenants labels tenants seen after the limit of distinct tenant labels was reached
+const OtherTenants = "other"
+
+// DefaultMaxTenants is the number of distinct tenant labels kept unless configured otherwise
+const DefaultMaxTenants = 50
+
+// TenantLabels caps the number of distinct tenant label values, so that a growing number of
+// tenants can not blow up the number of series. The first Max tenants seen keep their own label.
+type TenantLabels struct {
+	Max int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewTenantLabels creates new object of TenantLabels keeping at most max tenant labels
+func NewTenantLabels(max int) *TenantLabels {
+	return &TenantLabels{Max: max, seen: map[string]bool{}}
+}
+
+// Label returns tenant when it has its own label and OtherTenants otherwise
+func (t *TenantLabels) Label(tenant string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen[tenant] {
+		return tenant
+	}
+	if len(t.seen) >= t.Max {
+		return OtherTenants
+	}
+
+	t.seen[tenant] = true
+	return tenant
+}
+
+var (
+	tenantsMu sync.RWMutex
+	tenants   = NewTenantLabels(DefaultMaxTenants)
+)
+
+// LimitTenants sets the number of distinct tenant labels used by Tenant
+func LimitTenants(max int) {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	tenants = NewTenantLabels(max)
+}
+
+// Tenant returns the label of tenant shared by every metric partitioned by tenant
+func Tenant(tenant string) string {
+	tenantsMu.RLock()
+	defer tenantsMu.RUnlock()
+	return tenants.Label(tenant)
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import "testing"
+
+func TestTenantLabelsAreCapped(t *testing.T) {
+	tl := NewTenantLabels(2)
+
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		if label := tl.Label(tenant); label != tenant {
+			t.Errorf("tenant %s is labelled %s", tenant, label)
+		}
+	}
+
+	if label := tl.Label("initech"); label != OtherTenants {
+		t.Errorf("tenant over the limit is labelled %s but expected %s", label, OtherTenants)
+	}
+
+	if label := tl.Label("globex"); label != "globex" {
+		t.Errorf("known tenant is labelled %s after the limit was reached", label)
+	}
+}
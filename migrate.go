@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	"n_users/config"
+	"n_users/repo"
+)
+
+const migrateUsage = "usage: n_users migrate up | down [steps] | status"
+
+// runMigrate runs migrate subcommand against the configured database and returns exit code
+func runMigrate(cfg config.DatabaseConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, err := sql.Open("postgres", string(cfg.URL))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	m, err := repo.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error loading migrations:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := m.Up()
+		fmt.Printf("applied %d migrations\n", count)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+
+		count, err := m.Down(steps)
+		fmt.Printf("reverted %d migrations\n", count)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+
+		if err := m.Check(); err != nil {
+			fmt.Println(err)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
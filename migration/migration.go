@@ -0,0 +1,315 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultLockID is the postgres advisory lock key held while migrations run, ascii of "n_users"
+const DefaultLockID = int64(0x6e5f7573657273)
+
+var filePattern = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with SQL to apply and to revert it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status reports whether a migration is applied to the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads migrations from dir of fsys ordered by version. Every migration is a pair of
+// files named <version>_<name>.up.sql and <version>_<name>.down.sql, e.g. 0001_create_profiles.up.sql.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>.(up|down).sql", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		if version <= 0 {
+			return nil, fmt.Errorf("migration file %s must have a positive version", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations, recording applied versions in schema_migrations.
+// Up and Down hold a postgres advisory lock, so replicas starting at once migrate one at a time.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	LockID     int64
+}
+
+// New creates new object of Migrator
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{DB: db, Migrations: migrations, LockID: DefaultLockID}
+}
+
+// Latest returns version of the newest known migration, zero when there is none
+func (m *Migrator) Latest() int64 {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version returns the highest applied version, zero when no migration was applied
+func (m *Migrator) Version() (int64, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return 0, err
+	}
+
+	version := int64(0)
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+
+	return version, nil
+}
+
+// Check returns error unless every known migration and nothing else is applied
+func (m *Migrator) Check() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		if !s.Applied {
+			return fmt.Errorf("migration %d_%s is not applied, run migrate up", s.Version, s.Name)
+		}
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	if version != m.Latest() {
+		return fmt.Errorf("schema version %d is newer than latest known migration %d", version, m.Latest())
+	}
+
+	return nil
+}
+
+// Status returns every known migration with whether it is applied
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied(m.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		at, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: at})
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	count := 0
+
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err := m.run(conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, now())",
+				migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Down reverts the latest steps applied migrations and returns how many were reverted
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+
+	err := m.locked(func(conn *sql.Conn) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.Migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err := m.run(conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// run executes migration SQL and records it in one transaction, so a failed migration leaves no trace
+func (m *Migrator) run(conn *sql.Conn, script string, record string, args ...interface{}) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// locked runs fn on a single connection holding the advisory lock, advisory locks belong to the session
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.LockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", m.LockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// applied returns applied versions with the time they were applied, empty before the first migration
+func (m *Migrator) applied(q queryer) (map[int64]time.Time, error) {
+	ctx := context.Background()
+	applied := map[int64]time.Time{}
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0010_add_index.up.sql":       {Data: []byte("CREATE INDEX a")},
+		"sql/0010_add_index.down.sql":     {Data: []byte("DROP INDEX a")},
+		"sql/0002_create_table.up.sql":    {Data: []byte("CREATE TABLE a")},
+		"sql/0002_create_table.down.sql":  {Data: []byte("DROP TABLE a")},
+		"sql/0001_create_schema.up.sql":   {Data: []byte("CREATE SCHEMA a")},
+		"sql/0001_create_schema.down.sql": {Data: []byte("DROP SCHEMA a")},
+		"other/0003_not_loaded.up.sql":    {Data: []byte("SELECT 1")},
+		"other/0003_not_loaded.down.sql":  {Data: []byte("SELECT 1")},
+	}
+
+	migrations, err := Load(fsys, "sql")
+	if err != nil {
+		t.Fatalf("load migrations error %s", err)
+	}
+
+	expected := []int64{1, 2, 10}
+	if len(migrations) != len(expected) {
+		t.Fatalf("loaded %d migrations but expected %d", len(migrations), len(expected))
+	}
+
+	for i, m := range migrations {
+		if m.Version != expected[i] {
+			t.Errorf("migration %d has version %d but expected %d", i, m.Version, expected[i])
+		}
+	}
+
+	if m := migrations[1]; m.Name != "create_table" || m.Up != "CREATE TABLE a" || m.Down != "DROP TABLE a" {
+		t.Errorf("migration 2 loaded as %+v", m)
+	}
+
+	if latest := New(nil, migrations).Latest(); latest != 10 {
+		t.Errorf("latest migration is %d but expected 10", latest)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"sql/0001_a.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"bad name": {
+			"sql/1-a.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"zero version": {
+			"sql/0000_a.up.sql":   {Data: []byte("SELECT 1")},
+			"sql/0000_a.down.sql": {Data: []byte("SELECT 1")},
+		},
+		"duplicate version": {
+			"sql/0001_a.up.sql":   {Data: []byte("SELECT 1")},
+			"sql/0001_a.down.sql": {Data: []byte("SELECT 1")},
+			"sql/0001_b.up.sql":   {Data: []byte("SELECT 1")},
+			"sql/0001_b.down.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+
+	for name, fsys := range cases {
+		if _, err := Load(fsys, "sql"); err == nil {
+			t.Errorf("%s loaded without error", name)
+		}
+	}
+}
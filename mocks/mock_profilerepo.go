@@ -5,8 +5,10 @@
 package mocks
 
 import (
+	context "context"
 	entity "n_users/entity"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,33 +37,137 @@ func (m *MockProfileRepo) EXPECT() *MockProfileRepoMockRecorder {
 }
 
 // Create mocks base method.
-func (m *MockProfileRepo) Create(arg0 entity.Profile) (string, error) {
+func (m *MockProfileRepo) Create(arg0 context.Context, arg1 entity.Profile) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", arg0)
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockProfileRepoMockRecorder) Create(arg0 interface{}) *gomock.Call {
+func (mr *MockProfileRepoMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockProfileRepo)(nil).Create), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockProfileRepo)(nil).Create), arg0, arg1)
 }
 
 // Delete mocks base method.
-func (m *MockProfileRepo) Delete(arg0, arg1 string) (bool, error) {
+func (m *MockProfileRepo) Delete(arg0 context.Context, arg1, arg2 string, arg3 int64) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockProfileRepoMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockProfileRepoMockRecorder) Delete(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockProfileRepo)(nil).Delete), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockProfileRepo)(nil).Delete), arg0, arg1, arg2, arg3)
+}
+
+// Get mocks base method.
+func (m *MockProfileRepo) Get(arg0 context.Context, arg1, arg2 string) (entity.Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entity.Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockProfileRepoMockRecorder) Get(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockProfileRepo)(nil).Get), arg0, arg1, arg2)
+}
+
+// GetTenant mocks base method.
+func (m *MockProfileRepo) GetTenant(arg0 context.Context, arg1 string) (entity.Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenant", arg0, arg1)
+	ret0, _ := ret[0].(entity.Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenant indicates an expected call of GetTenant.
+func (mr *MockProfileRepoMockRecorder) GetTenant(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenant", reflect.TypeOf((*MockProfileRepo)(nil).GetTenant), arg0, arg1)
+}
+
+// History mocks base method.
+func (m *MockProfileRepo) History(arg0 context.Context, arg1, arg2 string, arg3 int, arg4 string) (entity.ProfileHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(entity.ProfileHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockProfileRepoMockRecorder) History(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockProfileRepo)(nil).History), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ImageKeysInUse mocks base method.
+func (m *MockProfileRepo) ImageKeysInUse(arg0 context.Context, arg1 []string, arg2 time.Time) (map[string]bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageKeysInUse", arg0, arg1, arg2)
+	ret0, _ := ret[0].(map[string]bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageKeysInUse indicates an expected call of ImageKeysInUse.
+func (mr *MockProfileRepoMockRecorder) ImageKeysInUse(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageKeysInUse", reflect.TypeOf((*MockProfileRepo)(nil).ImageKeysInUse), arg0, arg1, arg2)
+}
+
+// Ping mocks base method.
+func (m *MockProfileRepo) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockProfileRepoMockRecorder) Ping(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockProfileRepo)(nil).Ping), arg0)
+}
+
+// Purge mocks base method.
+func (m *MockProfileRepo) Purge(arg0 context.Context, arg1, arg2 string) (entity.Profile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entity.Profile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockProfileRepoMockRecorder) Purge(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockProfileRepo)(nil).Purge), arg0, arg1, arg2)
+}
+
+// Restore mocks base method.
+func (m *MockProfileRepo) Restore(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockProfileRepoMockRecorder) Restore(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockProfileRepo)(nil).Restore), arg0, arg1, arg2)
 }
 
 // SafeClose mocks base method.
@@ -77,46 +183,31 @@ func (mr *MockProfileRepoMockRecorder) SafeClose() *gomock.Call {
 }
 
 // Search mocks base method.
-func (m *MockProfileRepo) Search(arg0 string, arg1, arg2 int, arg3, arg4 string) ([]entity.Profile, error) {
+func (m *MockProfileRepo) Search(arg0 context.Context, arg1 entity.SearchProfileRequest, arg2 string) (entity.SearchProfileResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Search", arg0, arg1, arg2, arg3, arg4)
-	ret0, _ := ret[0].([]entity.Profile)
+	ret := m.ctrl.Call(m, "Search", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entity.SearchProfileResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Search indicates an expected call of Search.
-func (mr *MockProfileRepoMockRecorder) Search(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockProfileRepoMockRecorder) Search(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockProfileRepo)(nil).Search), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockProfileRepo)(nil).Search), arg0, arg1, arg2)
 }
 
 // Update mocks base method.
-func (m *MockProfileRepo) Update(arg0, arg1 map[string]interface{}) (bool, error) {
+func (m *MockProfileRepo) Update(arg0 context.Context, arg1, arg2 map[string]interface{}) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Update", arg0, arg1)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "Update", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Update indicates an expected call of Update.
-func (mr *MockProfileRepoMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockProfileRepo)(nil).Update), arg0, arg1)
-}
-
-// UploadProfileImage mocks base method.
-func (m *MockProfileRepo) UploadProfileImage(arg0 string, arg1 []byte) (bool, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadProfileImage", arg0, arg1)
-	ret0, _ := ret[0].(bool)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// UploadProfileImage indicates an expected call of UploadProfileImage.
-func (mr *MockProfileRepoMockRecorder) UploadProfileImage(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockProfileRepoMockRecorder) Update(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadProfileImage", reflect.TypeOf((*MockProfileRepo)(nil).UploadProfileImage), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockProfileRepo)(nil).Update), arg0, arg1, arg2)
 }
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"n_users/audit"
+	"n_users/auth"
+	"n_users/entity"
+	"n_users/tracing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrInvalidHistoryCursor is returned for history cursors that were not issued for the profile
+var ErrInvalidHistoryCursor = entity.NewDomainError(entity.KindValidation, "invalid_cursor", "cursor is malformed")
+
+// unaudited columns change with every write, are recorded on the entry itself or are internal
+var unaudited = map[string]bool{
+	"version":           true,
+	"created_at":        true,
+	"created_by":        true,
+	"updated_at":        true,
+	"updated_by":        true,
+	"profile_image_key": true,
+}
+
+// record appends the change of profile, made by the actor of ctx, to the audit trail in transaction tx
+func record(ctx context.Context, tx *gorm.DB, action string, profile entity.Profile, changes entity.FieldChanges) error {
+	entry := entity.AuditEntry{
+		TenantID:  profile.TenantID,
+		ProfileID: profile.ProfileID,
+		Action:    action,
+		Actor:     auth.Actor(ctx),
+		RequestID: audit.RequestID(ctx),
+		Version:   profile.Version,
+		Changes:   changes,
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// redact erases the values recorded by audit entries of the purged profile in transaction tx,
+// through the function of migration 0006. Entries keep which columns changed, by whom and when.
+func redact(tx *gorm.DB, profileID string, tenantID string) error {
+	return tx.Exec("SELECT redact_profile_audit(?, ?)", tenantID, profileID).Error
+}
+
+// changes returns audited columns whose values differ between before and after. A nil before
+// stands for a profile that did not exist, its blank columns are left out.
+func changes(tx *gorm.DB, before, after *entity.Profile) entity.FieldChanges {
+	old := columns(tx, before)
+	changes := entity.FieldChanges{}
+
+	for column, value := range columns(tx, after) {
+		previous, existed := old[column]
+		if !existed && isBlank(value) {
+			continue
+		}
+
+		if !reflect.DeepEqual(previous, value) {
+			changes[column] = entity.FieldChange{Before: previous, After: value}
+		}
+	}
+
+	return changes
+}
+
+// columns returns values of audited columns of p keyed by column name
+func columns(tx *gorm.DB, p *entity.Profile) map[string]interface{} {
+	values := map[string]interface{}{}
+	if p == nil {
+		return values
+	}
+
+	for _, f := range tx.NewScope(p).Fields() {
+		if f.IsIgnored || !f.IsNormal || unaudited[f.DBName] {
+			continue
+		}
+		values[f.DBName] = f.Field.Interface()
+	}
+
+	return values
+}
+
+func isBlank(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// reload reads the profile, deleted or not
+func reload(tx *gorm.DB, profileID string, tenantID string) (entity.Profile, error) {
+	var profile entity.Profile
+	err := tx.Unscoped().Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).First(&profile).Error
+	return profile, err
+}
+
+// History returns a page of the audit trail of the profile, newest entries first. Entries of
+// purged profiles are kept, so history is served for profiles that no longer exist.
+func (pr *profileRepo) History(ctx context.Context, profileID string, tenantID string, limit int, after string) (_ entity.ProfileHistory, err error) {
+	defer observeQuery("history", time.Now(), &err)
+
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var before int64
+	if len(after) > 0 {
+		c, err := decodeCursor(after)
+		id, ok := c.Value.(float64)
+		if err != nil || !ok || c.Column != "audit_id" || c.ProfileID != profileID {
+			return entity.ProfileHistory{}, ErrInvalidHistoryCursor
+		}
+		before = int64(id)
+	}
+
+	// one more entry than requested tells whether there is a next page
+	var entries []entity.AuditEntry
+	err = pr.read(ctx, func(db *gorm.DB) error {
+		db = db.Where("tenant_id = ? AND profile_id = ?", tenantID, profileID)
+		if before > 0 {
+			db = db.Where("audit_id < ?", before)
+		}
+		return db.Order("audit_id DESC").Limit(limit + 1).Find(&entries).Error
+	})
+
+	if err != nil {
+		tracing.Logger(ctx).Error(err.Error())
+		return entity.ProfileHistory{}, dbError(err)
+	}
+
+	history := entity.ProfileHistory{Items: entries}
+	if len(entries) > limit {
+		history.Items = entries[:limit]
+		last := history.Items[limit-1]
+		history.NextCursor = encodeCursor(cursor{Column: "audit_id", Direction: "DESC", Value: last.AuditID, ProfileID: profileID})
+	}
+
+	return history, nil
+}
@@ -0,0 +1,131 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"n_users/auth"
+	"n_users/config"
+	"n_users/entity"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jinzhu/gorm"
+)
+
+func TestChanges(t *testing.T) {
+	db, err := gorm.Open("postgres", noDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	before := entity.Profile{ProfileID: "201", TenantID: "acme", FullName: "Nimesh", EmailID: "nimesh@example.com", Active: true, Version: 3, UpdatedBy: "user-1"}
+	after := before
+	after.EmailID = "n.k@example.com"
+	after.Active = false
+	after.DeletedAt = &deleted
+	after.Version = 4
+	after.UpdatedBy = "admin"
+
+	expected := entity.FieldChanges{
+		"email_id":   {Before: "nimesh@example.com", After: "n.k@example.com"},
+		"active":     {Before: true, After: false},
+		"deleted_at": {Before: (*time.Time)(nil), After: &deleted},
+	}
+	if c := changes(db, &before, &after); !reflect.DeepEqual(c, expected) {
+		t.Errorf("changes are %v but expected %v", c, expected)
+	}
+
+	// a created profile lists its values, blank columns are left out
+	expected = entity.FieldChanges{
+		"profile_id": {Before: nil, After: "201"},
+		"tenant_id":  {Before: nil, After: "acme"},
+		"full_name":  {Before: nil, After: "Nimesh"},
+		"email_id":   {Before: nil, After: "nimesh@example.com"},
+		"active":     {Before: nil, After: true},
+	}
+	if c := changes(db, nil, &before); !reflect.DeepEqual(c, expected) {
+		t.Errorf("changes of created profile are %v but expected %v", c, expected)
+	}
+}
+
+func TestAuditedColumnsCanBeMasked(t *testing.T) {
+	db, err := gorm.Open("postgres", noDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var audited []string
+	for column := range columns(db, &entity.Profile{}) {
+		audited = append(audited, column)
+	}
+
+	expected := append([]string(nil), config.AuditedColumns...)
+	sort.Strings(audited)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(audited, expected) {
+		t.Errorf("audited columns are %v but config lets %v be masked", audited, expected)
+	}
+}
+
+func TestCreateRecordsAuditEntryInTransaction(t *testing.T) {
+	pr := recordingRepo(t)
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "user-1"})
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, "host/abc-000001")
+
+	if _, err := pr.Create(ctx, entity.Profile{ProfileID: "201", TenantID: "acme", EmailID: "nimesh@example.com"}); err != nil {
+		t.Fatalf("create error %s", err)
+	}
+
+	statements := recorded.reset()
+	var queries []string
+	for _, s := range statements {
+		words := strings.Fields(s.query)
+		if len(words) > 3 {
+			words = words[:3]
+		}
+		queries = append(queries, strings.Join(words, " "))
+	}
+
+	expected := []string{"BEGIN", `INSERT INTO "profiles"`, `INSERT INTO "profile_audit"`, "COMMIT"}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Fatalf("statements are %v but expected the audit entry in the transaction of the insert", queries)
+	}
+
+	values := map[interface{}]bool{}
+	for _, arg := range statements[2].args {
+		values[arg.Value] = true
+	}
+
+	for _, v := range []interface{}{"user-1", "host/abc-000001", entity.AuditCreate, int64(1)} {
+		if !values[v] {
+			t.Errorf("audit entry %v does not record %v", statements[2].args, v)
+		}
+	}
+}
+
+func TestHistoryRejectsForeignCursor(t *testing.T) {
+	pr := recordingRepo(t)
+
+	cases := map[string]string{
+		"malformed":     "!!",
+		"other profile": encodeCursor(cursor{Column: "audit_id", Direction: "DESC", Value: 7, ProfileID: "202"}),
+		"search cursor": encodeCursor(cursor{Column: "full_name", Direction: "ASC", Value: "Nimesh", ProfileID: "201"}),
+	}
+
+	for name, c := range cases {
+		if _, err := pr.History(context.Background(), "201", "acme", 10, c); !errors.Is(err, ErrInvalidHistoryCursor) {
+			t.Errorf("%s cursor gave %v", name, err)
+		}
+	}
+
+	if len(recorded.reset()) != 0 {
+		t.Errorf("invalid cursors reached the database")
+	}
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// readOnly runs statements that only read, Postgres refuses writes in such a transaction
+var readOnly = &sql.TxOptions{ReadOnly: true}
+
+// transaction runs fc in a transaction bound to ctx, it is committed when fc returns no error.
+// gorm v1 has no context support of its own, the transaction carries ctx instead. Once ctx is
+// done the driver cancels a running statement and the transaction is rolled back. Callbacks
+// read ctx from tx to start spans in its trace and to stamp who columns.
+func (pr *profileRepo) transaction(ctx context.Context, fc func(tx *gorm.DB) error) error {
+	return pr.begin(ctx, nil, fc)
+}
+
+// read runs fc in a read only transaction bound to ctx, so that a slow query is cancelled
+// with the request like statements of a write
+func (pr *profileRepo) read(ctx context.Context, fc func(db *gorm.DB) error) error {
+	return pr.begin(ctx, readOnly, fc)
+}
+
+func (pr *profileRepo) begin(ctx context.Context, opts *sql.TxOptions, fc func(tx *gorm.DB) error) error {
+	// handles of the transaction share the callbacks and log mode of pr.DB
+	tx := pr.DB.BeginTx(ctx, opts)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	// no-op once committed
+	defer tx.RollbackUnlessCommitted()
+
+	err := fc(tx.Set(contextKey, ctx))
+	if err == nil {
+		err = tx.Commit().Error
+	}
+
+	// statements following the rollback of a done context fail with ErrTxDone
+	if errors.Is(err, sql.ErrTxDone) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,210 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"n_users/entity"
+
+	"github.com/jinzhu/gorm"
+)
+
+// recorder is a database driver recording the statements reaching it. Inserts succeed,
+// returning id 1, other statements fail with errNoRows.
+type recorder struct {
+	mu         sync.Mutex
+	statements []statement
+}
+
+type statement struct {
+	ctx   context.Context
+	query string
+	args  []driver.NamedValue
+}
+
+var (
+	recorded   = &recorder{}
+	errNoRows  = errors.New("recorder holds no rows")
+	registered sync.Once
+)
+
+func (d *recorder) record(ctx context.Context, query string, args []driver.NamedValue) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, statement{ctx: ctx, query: query, args: args})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.HasPrefix(query, "INSERT") || query == "BEGIN" || query == "COMMIT" {
+		return nil
+	}
+	return errNoRows
+}
+
+func (d *recorder) reset() []statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	statements := d.statements
+	d.statements = nil
+	return statements
+}
+
+// queries returns and forgets the recorded statements other than transaction control
+func (d *recorder) queries() []statement {
+	var queries []statement
+	for _, s := range d.reset() {
+		if s.query != "BEGIN" && s.query != "COMMIT" && s.query != "ROLLBACK" {
+			queries = append(queries, s)
+		}
+	}
+	return queries
+}
+
+func (d *recorder) Open(name string) (driver.Conn, error) {
+	return recorderConn{d}, nil
+}
+
+type recorderConn struct {
+	d *recorder
+}
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("recorder does not prepare statements")
+}
+
+func (c recorderConn) Close() error {
+	return nil
+}
+
+func (c recorderConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("recorder begins transactions with context only")
+}
+
+func (c recorderConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c, c.d.record(ctx, "BEGIN", nil)
+}
+
+func (c recorderConn) Commit() error {
+	return c.d.record(context.Background(), "COMMIT", nil)
+}
+
+func (c recorderConn) Rollback() error {
+	c.d.record(context.Background(), "ROLLBACK", nil)
+	return nil
+}
+
+func (c recorderConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.d.record(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return &idRows{}, nil
+}
+
+func (c recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.d.record(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// idRows holds the id returned by an insert
+type idRows struct {
+	done bool
+}
+
+func (r *idRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *idRows) Close() error {
+	return nil
+}
+
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func recordingRepo(t *testing.T) *profileRepo {
+	registered.Do(func() { sql.Register("recorder", recorded) })
+
+	sqlDB, err := sql.Open("recorder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded.reset()
+	return newProfileRepo(db)
+}
+
+func TestTransactionsAreBoundToContext(t *testing.T) {
+	pr := recordingRepo(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	pr.Get(ctx, "201", "acme")
+	pr.Purge(ctx, "201", "acme")
+
+	// the read of Get, then the Purge transaction, each rolled back once the select fails
+	statements := recorded.reset()
+	if len(statements) != 6 || statements[0].query != "BEGIN" || statements[3].query != "BEGIN" {
+		t.Fatalf("driver was reached by %v but expected two transactions", statements)
+	}
+
+	for _, i := range []int{0, 3} {
+		if d, ok := statements[i].ctx.Deadline(); !ok || !d.Equal(deadline) {
+			t.Errorf("transaction %d was begun without the deadline of the request", i/3)
+		}
+	}
+}
+
+func TestCancelledQueriesTimeOut(t *testing.T) {
+	pr := recordingRepo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := pr.Get(ctx, "201", "acme")
+	if e := entity.AsDomainError(err); e.Kind != entity.KindTimeout {
+		t.Errorf("query of cancelled request failed with %v but expected timeout", err)
+	}
+
+	if _, err := pr.Update(ctx, map[string]interface{}{"profile_id": "201", "tenant_id": "acme"}, map[string]interface{}{"full_name": "Nimesh"}); entity.AsDomainError(err).Kind != entity.KindTimeout {
+		t.Errorf("update of cancelled request failed with %v but expected timeout", err)
+	}
+}
+
+func TestImageKeysOfLongDeletedProfilesAreNotInUse(t *testing.T) {
+	pr := recordingRepo(t)
+
+	cutoff := time.Now().Add(-time.Hour)
+	pr.ImageKeysInUse(context.Background(), []string{"img"}, cutoff)
+
+	statements := recorded.queries()
+	if len(statements) != 1 || !strings.Contains(statements[0].query, "deleted_at IS NULL OR deleted_at >") {
+		t.Fatalf("image keys in use are read with %v", statements)
+	}
+
+	if args := statements[0].args; len(args) != 2 || args[1].Value != cutoff {
+		t.Errorf("image keys in use are read with %v but expected the sweep cutoff", args)
+	}
+}
@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+
+	"n_users/entity"
+
+	"github.com/jinzhu/gorm"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 1000
+
+// cursor marks the position of the last profile returned in a search page.
+// It carries the sort column so that a cursor can not be replayed against a different ordering.
+type cursor struct {
+	Column    string      `json:"c"`
+	Direction string      `json:"d"`
+	Value     interface{} `json:"v,omitempty"`
+	ProfileID string      `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, filterErrorf("cursor is malformed")
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil || len(c.ProfileID) == 0 {
+		return c, filterErrorf("cursor is malformed")
+	}
+
+	return c, nil
+}
+
+// sortKey is the column or expression search results are ordered by
+type sortKey struct {
+	Name      string
+	SQL       string
+	Args      []interface{}
+	Direction string
+	// Nullable keys sort NULL last in either direction, a cursor on NULL carries no value
+	Nullable bool
+}
+
+// orderBy returns ORDER BY clauses for the key, with profile_id as tie breaker
+func (k sortKey) orderBy() []interface{} {
+	order := k.SQL + " " + k.Direction
+	if k.Nullable {
+		order += " NULLS LAST"
+	}
+
+	orders := []interface{}{gorm.Expr(order, k.Args...)}
+	if k.Name != "profile_id" {
+		orders = append(orders, "profile_id "+k.Direction)
+	}
+	return orders
+}
+
+// keysetCondition returns the condition selecting rows after the cursor position
+func keysetCondition(c cursor, k sortKey) (string, []interface{}) {
+	op := ">"
+	if k.Direction == "DESC" {
+		op = "<"
+	}
+
+	if k.Name == "profile_id" {
+		return "profile_id " + op + " ?", []interface{}{c.ProfileID}
+	}
+
+	// a row comparison with NULL is never true, rows with NULL are only compared by profile_id
+	if k.Nullable && c.Value == nil {
+		return "(" + k.SQL + " IS NULL AND profile_id " + op + " ?)", append(append([]interface{}{}, k.Args...), c.ProfileID)
+	}
+
+	args := append(append([]interface{}{}, k.Args...), c.Value, c.ProfileID)
+	if k.Nullable {
+		return "((" + k.SQL + ", profile_id) " + op + " (?, ?) OR " + k.SQL + " IS NULL)", append(args, k.Args...)
+	}
+	return "(" + k.SQL + ", profile_id) " + op + " (?, ?)", args
+}
+
+// columnValue returns value of the profile field stored in the given column
+func columnValue(p entity.Profile, column string) interface{} {
+	v := reflect.ValueOf(p)
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if gorm.ToColumnName(t.Field(i).Name) == column {
+			return v.Field(i).Interface()
+		}
+	}
+
+	return nil
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+
+	return limit
+}
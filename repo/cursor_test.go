@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"n_users/entity"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := cursor{Column: "full_name", Direction: "DESC", Value: "Nimesh", ProfileID: "101"}
+
+	decoded, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatalf("cursor decoding error %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, c) {
+		t.Errorf("decoded cursor is %v but expected %v", decoded, c)
+	}
+
+	if _, err := decodeCursor("not a cursor"); err == nil {
+		t.Errorf("malformed cursor decoded without error")
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	c := cursor{Column: "full_name", Direction: "DESC", Value: "Nimesh", ProfileID: "101"}
+	condition, values := keysetCondition(c, sortKey{Name: "full_name", SQL: "full_name", Direction: "DESC"})
+	if condition != "(full_name, profile_id) < (?, ?)" || len(values) != 2 {
+		t.Errorf("keyset condition is %s %v", condition, values)
+	}
+
+	// NULL sorts last, pages reaching it continue among the NULL rows
+	deleted := sortKey{Name: "deleted_at", SQL: "deleted_at", Direction: "ASC", Nullable: true}
+	c = cursor{Column: "deleted_at", Direction: "ASC", Value: "2021-05-01T00:00:00Z", ProfileID: "101"}
+	condition, values = keysetCondition(c, deleted)
+	if condition != "((deleted_at, profile_id) > (?, ?) OR deleted_at IS NULL)" || len(values) != 2 {
+		t.Errorf("keyset condition is %s %v", condition, values)
+	}
+
+	c = cursor{Column: "deleted_at", Direction: "ASC", ProfileID: "101"}
+	condition, values = keysetCondition(c, deleted)
+	if condition != "(deleted_at IS NULL AND profile_id > ?)" || len(values) != 1 || values[0] != "101" {
+		t.Errorf("keyset condition after NULL is %s %v", condition, values)
+	}
+
+	if order := deleted.orderBy(); !reflect.DeepEqual(order[0], gorm.Expr("deleted_at ASC NULLS LAST")) {
+		t.Errorf("nullable key is ordered by %v", order)
+	}
+
+	c = cursor{Column: "profile_id", Direction: "ASC", ProfileID: "101"}
+	condition, values = keysetCondition(c, sortKey{Name: "profile_id", SQL: "profile_id", Direction: "ASC"})
+	if condition != "profile_id > ?" || len(values) != 1 {
+		t.Errorf("keyset condition is %s %v", condition, values)
+	}
+}
+
+func TestColumnValue(t *testing.T) {
+	p := entity.Profile{ProfileID: "101", FullName: "Nimesh", Latitude: 12.5}
+
+	if v := columnValue(p, "full_name"); v != "Nimesh" {
+		t.Errorf("full_name column value is %v but expected Nimesh", v)
+	}
+
+	if v := columnValue(p, "latitude"); v != 12.5 {
+		t.Errorf("latitude column value is %v but expected 12.5", v)
+	}
+}
+
+func TestIncludeTotalRequiresCursor(t *testing.T) {
+	pr := recordingRepo(t)
+
+	_, err := pr.Search(context.Background(), entity.SearchProfileRequest{IncludeTotal: true, Limit: 10}, "acme")
+	if e := entity.AsDomainError(err); e.Code != "invalid_search" {
+		t.Errorf("offset search with total gave %v but expected invalid_search", err)
+	}
+
+	if len(recorded.reset()) != 0 {
+		t.Errorf("offset search with total reached the database")
+	}
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"n_users/entity"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotFound is returned when the requested profile does not exist for the tenant
+var ErrNotFound = entity.NewDomainError(entity.KindNotFound, "profile_not_found", "profile not found")
+
+// ErrVersionMismatch is returned when the profile was changed since the version the caller expected
+var ErrVersionMismatch = entity.NewDomainError(entity.KindPreconditionFailed, "version_mismatch", "profile version does not match")
+
+// uniqueConstraints maps unique constraints of profiles to the field they protect
+var uniqueConstraints = map[string]string{
+	"profiles_pkey":             "profile_id",
+	"idx_profile_tenant_email":  "email_id",
+	"idx_profile_tenant_mobile": "mobile",
+}
+
+// dbError classifies database error as a domain error, nil stays nil
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// the context of the query was cancelled or its deadline passed
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return entity.WrapError(entity.KindTimeout, "request_timeout", "request timed out", err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505":
+			return duplicateError(pqErr)
+		// query_canceled, the driver cancels statements still running when their context is done
+		case pqErr.Code == "57014":
+			return entity.WrapError(entity.KindTimeout, "request_timeout", "request timed out", err)
+		// connection exceptions, insufficient resources and operator intervention
+		case strings.HasPrefix(string(pqErr.Code), "08"),
+			strings.HasPrefix(string(pqErr.Code), "53"),
+			strings.HasPrefix(string(pqErr.Code), "57P"):
+			return entity.WrapError(entity.KindUnavailable, "database_unavailable", "database is unavailable", err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return entity.WrapError(entity.KindUnavailable, "database_unavailable", "database is unavailable", err)
+	}
+
+	return entity.WrapError(entity.KindInternal, "database_error", "database error", err)
+}
+
+// duplicateError names the field that violated a unique constraint. The cause is not
+// wrapped, its detail would leak constraint names and values to clients.
+func duplicateError(pqErr *pq.Error) error {
+	field, ok := uniqueConstraints[pqErr.Constraint]
+	if !ok {
+		return entity.NewDomainError(entity.KindConflict, "duplicate_profile", "profile already exists")
+	}
+
+	fields := entity.FieldErrors{{Field: field, Code: "duplicate", Message: "is already used by another profile"}}
+	return entity.WrapError(entity.KindConflict, "duplicate_profile", "", fields)
+}
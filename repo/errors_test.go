@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"n_users/entity"
+
+	"github.com/lib/pq"
+)
+
+func TestDBError(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind entity.ErrorKind
+		code string
+	}{
+		{&pq.Error{Code: "23505", Constraint: "idx_profile_tenant_email"}, entity.KindConflict, "duplicate_profile"},
+		{&pq.Error{Code: "23505", Constraint: "unknown"}, entity.KindConflict, "duplicate_profile"},
+		{&pq.Error{Code: "08006"}, entity.KindUnavailable, "database_unavailable"},
+		{&pq.Error{Code: "57P01"}, entity.KindUnavailable, "database_unavailable"},
+		{driver.ErrBadConn, entity.KindUnavailable, "database_unavailable"},
+		{&pq.Error{Code: "57014"}, entity.KindTimeout, "request_timeout"},
+		{fmt.Errorf("select: %w", context.DeadlineExceeded), entity.KindTimeout, "request_timeout"},
+		{context.Canceled, entity.KindTimeout, "request_timeout"},
+		{&pq.Error{Code: "42601"}, entity.KindInternal, "database_error"},
+		{errors.New("boom"), entity.KindInternal, "database_error"},
+	}
+
+	for _, c := range cases {
+		e := entity.AsDomainError(dbError(c.err))
+		if e.Kind != c.kind || e.Code != c.code {
+			t.Errorf("%v classified as %s %s but expected %s %s", c.err, e.Kind, e.Code, c.kind, c.code)
+		}
+	}
+
+	var fields entity.FieldErrors
+	err := dbError(&pq.Error{Code: "23505", Constraint: "idx_profile_tenant_mobile", Detail: "Key (tenant_id, mobile)=(mars, +14155550123) already exists."})
+	if !errors.As(err, &fields) || len(fields) != 1 || fields[0].Field != "mobile" {
+		t.Errorf("duplicate mobile error %v does not name the mobile field", err)
+	}
+
+	if strings.Contains(err.Error(), "mars") || strings.Contains(err.Error(), "idx_") {
+		t.Errorf("duplicate mobile error %q leaks database details", err)
+	}
+
+	if dbError(nil) != nil {
+		t.Errorf("nil error classified as domain error")
+	}
+}
@@ -0,0 +1,270 @@
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"n_users/entity"
+	"n_users/validation"
+)
+
+const maxFilterDepth = 8
+const maxFilterValues = 100
+
+// profileColumns lists the profile columns that can be used in search filters and sorting
+var profileColumns = map[string]bool{
+	"profile_id":        true,
+	"full_name":         true,
+	"gender":            true,
+	"email_id":          true,
+	"mobile":            true,
+	"birth_date":        true,
+	"city_id":           true,
+	"country_id":        true,
+	"address":           true,
+	"latitude":          true,
+	"longitude":         true,
+	"profile_image_url": true,
+	"active":            true,
+	"created_by":        true,
+	"created_at":        true,
+	"updated_by":        true,
+	"updated_at":        true,
+	"deleted_by":        true,
+	"deleted_at":        true,
+}
+
+// normalizedColumns are stored normalized, filter values are normalized the same way to match them
+var normalizedColumns = map[string]func(string) string{
+	"email_id": validation.NormalizeEmail,
+	"mobile":   validation.NormalizeMobile,
+}
+
+// normalize returns the string value v of column as it is stored, other values are returned unchanged
+func normalize(column string, v interface{}) interface{} {
+	fn, ok := normalizedColumns[column]
+	s, isString := v.(string)
+	if !ok || !isString {
+		return v
+	}
+	return fn(s)
+}
+
+// FilterError is the cause of validation errors returned when a search filter or sort expression is invalid
+type FilterError struct {
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return "invalid search filter: " + e.Reason
+}
+
+func filterErrorf(format string, args ...interface{}) error {
+	return entity.WrapError(entity.KindValidation, "invalid_search", "", &FilterError{Reason: fmt.Sprintf(format, args...)})
+}
+
+// compileFilter converts filter into a parameterized SQL condition
+func compileFilter(f *entity.Filter) (string, []interface{}, error) {
+	if f == nil {
+		return "", nil, nil
+	}
+
+	var args []interface{}
+	sql, err := compileNode(*f, 0, &args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sql, args, nil
+}
+
+func compileNode(f entity.Filter, depth int, args *[]interface{}) (string, error) {
+	if depth >= maxFilterDepth {
+		return "", filterErrorf("filter is nested deeper than %d levels", maxFilterDepth)
+	}
+
+	switch f.Op {
+	case entity.FilterAnd, entity.FilterOr:
+		if len(f.Filters) == 0 {
+			return "", filterErrorf("%q requires at least one filter", f.Op)
+		}
+
+		parts := make([]string, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			part, err := compileNode(child, depth+1, args)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+
+		return "(" + strings.Join(parts, " "+strings.ToUpper(f.Op)+" ") + ")", nil
+
+	case entity.FilterNot:
+		if len(f.Filters) != 1 {
+			return "", filterErrorf("%q requires exactly one filter", f.Op)
+		}
+
+		part, err := compileNode(f.Filters[0], depth+1, args)
+		if err != nil {
+			return "", err
+		}
+
+		return "(NOT " + part + ")", nil
+
+	case entity.FilterEq, entity.FilterNe, entity.FilterIn, entity.FilterPrefix, entity.FilterRange:
+		if err := checkColumn(f.Field); err != nil {
+			return "", err
+		}
+		return compileLeaf(f, args)
+	}
+
+	return "", filterErrorf("unknown operator %q, supported operators are %s", f.Op, supportedOperators())
+}
+
+func compileLeaf(f entity.Filter, args *[]interface{}) (string, error) {
+	switch f.Op {
+	case entity.FilterEq, entity.FilterNe:
+		if f.Value == nil {
+			if f.Op == entity.FilterEq {
+				return f.Field + " IS NULL", nil
+			}
+			return f.Field + " IS NOT NULL", nil
+		}
+
+		if err := checkScalar(f.Field, f.Value); err != nil {
+			return "", err
+		}
+
+		*args = append(*args, normalize(f.Field, f.Value))
+		if f.Op == entity.FilterEq {
+			return f.Field + " = ?", nil
+		}
+		return f.Field + " <> ?", nil
+
+	case entity.FilterIn:
+		if len(f.Values) == 0 {
+			return "", filterErrorf("%q on field %q requires a non empty values list", f.Op, f.Field)
+		}
+
+		if len(f.Values) > maxFilterValues {
+			return "", filterErrorf("%q on field %q accepts at most %d values", f.Op, f.Field, maxFilterValues)
+		}
+
+		values := make([]interface{}, len(f.Values))
+		for i, v := range f.Values {
+			if err := checkScalar(f.Field, v); err != nil {
+				return "", err
+			}
+			values[i] = normalize(f.Field, v)
+		}
+
+		*args = append(*args, values)
+		return f.Field + " IN (?)", nil
+
+	case entity.FilterPrefix:
+		prefix, ok := f.Value.(string)
+		if !ok || len(prefix) == 0 {
+			return "", filterErrorf("%q on field %q requires a non empty string value", f.Op, f.Field)
+		}
+
+		*args = append(*args, escapeLike(normalize(f.Field, prefix).(string))+"%")
+		return f.Field + " LIKE ?", nil
+	}
+
+	// range
+	bounds := []struct {
+		op    string
+		value interface{}
+	}{{">", f.Gt}, {">=", f.Gte}, {"<", f.Lt}, {"<=", f.Lte}}
+
+	parts := []string{}
+	for _, b := range bounds {
+		if b.value == nil {
+			continue
+		}
+
+		if err := checkScalar(f.Field, b.value); err != nil {
+			return "", err
+		}
+
+		*args = append(*args, normalize(f.Field, b.value))
+		parts = append(parts, f.Field+" "+b.op+" ?")
+	}
+
+	if len(parts) == 0 {
+		return "", filterErrorf("%q on field %q requires at least one of gt, gte, lt or lte", f.Op, f.Field)
+	}
+
+	return "(" + strings.Join(parts, " AND ") + ")", nil
+}
+
+// parseSort splits sort expression like "full_name desc" into a whitelisted column and direction
+func parseSort(sortBy string) (string, string, error) {
+	parts := strings.Fields(sortBy)
+
+	switch len(parts) {
+	case 0:
+		return "", "", nil
+	case 1, 2:
+	default:
+		return "", "", filterErrorf("sort_by %q must be in the form \"<field> [asc|desc]\"", sortBy)
+	}
+
+	column := strings.ToLower(parts[0])
+	if err := checkColumn(column); err != nil {
+		return "", "", err
+	}
+
+	direction := "ASC"
+	if len(parts) == 2 {
+		direction = strings.ToUpper(parts[1])
+		if direction != "ASC" && direction != "DESC" {
+			return "", "", filterErrorf("sort direction %q must be asc or desc", parts[1])
+		}
+	}
+
+	return column, direction, nil
+}
+
+func checkColumn(field string) error {
+	if len(field) == 0 {
+		return filterErrorf("field is required")
+	}
+
+	if !profileColumns[field] {
+		return filterErrorf("unknown field %q, supported fields are %s", field, supportedColumns())
+	}
+
+	return nil
+}
+
+func checkScalar(field string, v interface{}) error {
+	switch v.(type) {
+	case string, float64, bool:
+		return nil
+	}
+
+	return filterErrorf("value %v for field %q must be a string, number or boolean", v, field)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func supportedColumns() string {
+	columns := make([]string, 0, len(profileColumns))
+	for c := range profileColumns {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	return strings.Join(columns, ", ")
+}
+
+func supportedOperators() string {
+	return strings.Join([]string{
+		entity.FilterEq, entity.FilterNe, entity.FilterIn, entity.FilterPrefix,
+		entity.FilterRange, entity.FilterAnd, entity.FilterOr, entity.FilterNot,
+	}, ", ")
+}
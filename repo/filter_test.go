@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"n_users/entity"
+)
+
+func parseFilter(t *testing.T, s string) *entity.Filter {
+	var f entity.Filter
+	if err := json.Unmarshal([]byte(s), &f); err != nil {
+		t.Fatalf("filter parsing error %s", err)
+	}
+	return &f
+}
+
+func TestCompileFilter(t *testing.T) {
+	f := parseFilter(t, `{"op":"and","filters":[
+		{"field":"full_name","op":"prefix","value":"Ni_m"},
+		{"op":"or","filters":[
+			{"field":"gender","op":"in","values":["M","F"]},
+			{"op":"not","filters":[{"field":"city_id","op":"eq","value":"blr"}]}
+		]},
+		{"field":"birth_date","op":"range","gte":"1990-01-01","lt":"2000-01-01"},
+		{"field":"mobile","op":"ne","value":null}
+	]}`)
+
+	sql, args, err := compileFilter(f)
+	if err != nil {
+		t.Fatalf("compile filter error %s", err)
+	}
+
+	expectedSQL := "(full_name LIKE ? AND (gender IN (?) OR (NOT city_id = ?)) AND " +
+		"(birth_date >= ? AND birth_date < ?) AND mobile IS NOT NULL)"
+	if sql != expectedSQL {
+		t.Errorf("compiled sql is %s but expected %s", sql, expectedSQL)
+	}
+
+	expectedArgs := []interface{}{`Ni\_m%`, []interface{}{"M", "F"}, "blr", "1990-01-01", "2000-01-01"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("compiled args are %v but expected %v", args, expectedArgs)
+	}
+}
+
+func TestCompileFilterNormalizesContacts(t *testing.T) {
+	f := parseFilter(t, `{"op":"or","filters":[
+		{"field":"email_id","op":"eq","value":" Nimesh@Example.COM "},
+		{"field":"email_id","op":"prefix","value":"NIM"},
+		{"field":"mobile","op":"in","values":["+91 88888-00000","0091 (888) 8800001"]},
+		{"field":"full_name","op":"eq","value":"Nimesh K"}
+	]}`)
+
+	_, args, err := compileFilter(f)
+	if err != nil {
+		t.Fatalf("compile filter error %s", err)
+	}
+
+	expectedArgs := []interface{}{"nimesh@example.com", "nim%", []interface{}{"+918888800000", "+918888800001"}, "Nimesh K"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("compiled args are %v but expected %v", args, expectedArgs)
+	}
+}
+
+func TestCompileFilterRejectsInvalidInput(t *testing.T) {
+	filters := []string{
+		`{"field":"tenant_id","op":"eq","value":"mars"}`,
+		`{"field":"full_name; drop table profiles","op":"eq","value":"x"}`,
+		`{"field":"full_name","op":"like","value":"x"}`,
+		`{"field":"full_name","op":"eq","value":{"a":1}}`,
+		`{"field":"full_name","op":"in","values":[]}`,
+		`{"field":"birth_date","op":"range"}`,
+		`{"op":"not","filters":[]}`,
+		`{"op":"and"}`,
+	}
+
+	for _, s := range filters {
+		_, _, err := compileFilter(parseFilter(t, s))
+
+		var filterErr *FilterError
+		if !errors.As(err, &filterErr) {
+			t.Errorf("filter %s compiled without validation error", s)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	cases := map[string]string{
+		"":               " ",
+		"full_name":      "full_name ASC",
+		"Gender desc":    "gender DESC",
+		"created_at asc": "created_at ASC",
+	}
+
+	for in, expected := range cases {
+		column, direction, err := parseSort(in)
+		if out := column + " " + direction; err != nil || out != expected {
+			t.Errorf("sort %q parsed to %q, %v but expected %q", in, out, err, expected)
+		}
+	}
+
+	for _, in := range []string{"gender; drop table profiles", "gender sideways", "password"} {
+		if _, _, err := parseSort(in); err == nil {
+			t.Errorf("sort %q parsed without validation error", in)
+		}
+	}
+}
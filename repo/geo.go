@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"n_users/entity"
+	"n_users/geo"
+)
+
+const maxRadiusKM = 20000
+
+// distanceSQL evaluates haversine distance in km between each row and a point, the formula of geo.Distance.
+// Served distances are always the ones computed by Postgres, never recomputed in Go.
+const distanceSQL = "(2 * 6371.0088 * asin(sqrt(least(1, " +
+	"power(sin(radians(latitude - ?) / 2), 2) + " +
+	"cos(radians(?)) * cos(radians(latitude)) * power(sin(radians(longitude - ?) / 2), 2)))))"
+
+// geoSearch holds the compiled parts of a location based search.
+//
+// Without PostGIS there is no spatial index, so every search first narrows rows
+// with a latitude/longitude rectangle that can use the btree idx_profile_location
+// index, and only then evaluates the exact distance for the remaining rows.
+type geoSearch struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKM  float64
+	Bounds    geo.Bounds
+}
+
+func compileGeo(q *entity.GeoQuery) (*geoSearch, error) {
+	if q == nil {
+		return nil, nil
+	}
+
+	switch {
+	case q.Box != nil && q.RadiusKM != 0:
+		return nil, filterErrorf("geo search accepts either radius_km or bbox, not both")
+
+	case q.Box != nil:
+		sw, ne := q.Box.SouthWest, q.Box.NorthEast
+		if !geo.ValidPoint(sw.Latitude, sw.Longitude) || !geo.ValidPoint(ne.Latitude, ne.Longitude) {
+			return nil, filterErrorf("bbox corners must have lat within [-90, 90] and lon within [-180, 180]")
+		}
+
+		if sw.Latitude > ne.Latitude {
+			return nil, filterErrorf("bbox south_west lat must not be greater than north_east lat")
+		}
+
+		g := &geoSearch{Bounds: geo.Bounds{
+			MinLatitude:  sw.Latitude,
+			MinLongitude: sw.Longitude,
+			MaxLatitude:  ne.Latitude,
+			MaxLongitude: ne.Longitude,
+		}}
+
+		g.Latitude, g.Longitude = g.Bounds.Center()
+		if q.Near != nil {
+			if !geo.ValidPoint(q.Near.Latitude, q.Near.Longitude) {
+				return nil, filterErrorf("near must have lat within [-90, 90] and lon within [-180, 180]")
+			}
+			g.Latitude, g.Longitude = q.Near.Latitude, q.Near.Longitude
+		}
+
+		return g, nil
+
+	case q.Near != nil:
+		if !geo.ValidPoint(q.Near.Latitude, q.Near.Longitude) {
+			return nil, filterErrorf("near must have lat within [-90, 90] and lon within [-180, 180]")
+		}
+
+		if q.RadiusKM <= 0 || q.RadiusKM > maxRadiusKM {
+			return nil, filterErrorf("radius_km must be greater than 0 and at most %d", maxRadiusKM)
+		}
+
+		return &geoSearch{
+			Latitude:  q.Near.Latitude,
+			Longitude: q.Near.Longitude,
+			RadiusKM:  q.RadiusKM,
+			Bounds:    geo.BoundsAround(q.Near.Latitude, q.Near.Longitude, q.RadiusKM),
+		}, nil
+	}
+
+	return nil, filterErrorf("geo search requires near with radius_km, or bbox")
+}
+
+// condition returns the SQL restricting rows to the searched area
+func (g *geoSearch) condition() (string, []interface{}) {
+	b := g.Bounds
+
+	sql := "latitude BETWEEN ? AND ?"
+	args := []interface{}{b.MinLatitude, b.MaxLatitude}
+
+	if b.CrossesAntimeridian() {
+		sql += " AND (longitude >= ? OR longitude <= ?)"
+	} else {
+		sql += " AND longitude BETWEEN ? AND ?"
+	}
+	args = append(args, b.MinLongitude, b.MaxLongitude)
+
+	if g.RadiusKM > 0 {
+		sql += " AND " + distanceSQL + " <= ?"
+		args = append(args, g.distanceArgs()...)
+		args = append(args, g.RadiusKM)
+	}
+
+	return sql, args
+}
+
+func (g *geoSearch) distanceArgs() []interface{} {
+	return []interface{}{g.Latitude, g.Latitude, g.Longitude}
+}
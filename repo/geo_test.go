@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"n_users/entity"
+)
+
+func TestCompileGeoRadius(t *testing.T) {
+	g, err := compileGeo(&entity.GeoQuery{Near: &entity.GeoPoint{Latitude: 12.97, Longitude: 77.59}, RadiusKM: 5})
+	if err != nil {
+		t.Fatalf("compile geo error %s", err)
+	}
+
+	sql, args := g.condition()
+	expectedSQL := "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ? AND " + distanceSQL + " <= ?"
+	if sql != expectedSQL || len(args) != 8 {
+		t.Errorf("geo condition is %s %v", sql, args)
+	}
+}
+
+func TestCompileGeoBox(t *testing.T) {
+	g, err := compileGeo(&entity.GeoQuery{Box: &entity.GeoBox{
+		SouthWest: entity.GeoPoint{Latitude: -10, Longitude: 170},
+		NorthEast: entity.GeoPoint{Latitude: 10, Longitude: -170},
+	}})
+	if err != nil {
+		t.Fatalf("compile geo error %s", err)
+	}
+
+	sql, _ := g.condition()
+	if sql != "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)" {
+		t.Errorf("geo condition across antimeridian is %s", sql)
+	}
+
+	if g.Latitude != 0 || g.Longitude != 180 {
+		t.Errorf("box center is %f, %f but expected 0, 180", g.Latitude, g.Longitude)
+	}
+}
+
+func TestCompileGeoRejectsInvalidInput(t *testing.T) {
+	queries := []entity.GeoQuery{
+		{},
+		{Near: &entity.GeoPoint{Latitude: 91}, RadiusKM: 5},
+		{Near: &entity.GeoPoint{}, RadiusKM: -1},
+		{Near: &entity.GeoPoint{}, RadiusKM: 5, Box: &entity.GeoBox{}},
+		{Box: &entity.GeoBox{SouthWest: entity.GeoPoint{Latitude: 10}, NorthEast: entity.GeoPoint{Latitude: -10}}},
+	}
+
+	for _, q := range queries {
+		q := q
+		if _, err := compileGeo(&q); err == nil {
+			t.Errorf("geo query %+v compiled without validation error", q)
+		}
+	}
+}
+
+func TestGeoSearchReadsDistanceFromQuery(t *testing.T) {
+	pr := recordingRepo(t)
+
+	pr.Search(context.Background(), entity.SearchProfileRequest{
+		Geo:        &entity.GeoQuery{Near: &entity.GeoPoint{Latitude: 12.97, Longitude: 77.59}, RadiusKM: 5},
+		Pagination: "cursor",
+	}, "acme")
+
+	statements := recorded.queries()
+	if len(statements) != 1 || !strings.Contains(statements[0].query, ") AS search_distance FROM") {
+		t.Fatalf("geo search ran %v but expected the distance selected by the query", statements)
+	}
+}
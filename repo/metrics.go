@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "n_users_db_query_duration_seconds",
+	Help:    "Latency of profile queries by operation and outcome.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation", "outcome"})
+
+// observeQuery records duration of operation started at start, meant to be deferred with a pointer
+// to the named error result of the operation
+func observeQuery(operation string, start time.Time, err *error) {
+	outcome := "ok"
+	if *err != nil {
+		outcome = "error"
+	}
+	queryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+var (
+	poolStatsMu sync.Mutex
+	poolStats   prometheus.Collector
+)
+
+// registerPoolStats exposes connection pool stats of db as go_sql_* metrics, replacing those of a
+// database opened before. They are read on every scrape.
+func registerPoolStats(db *sql.DB) {
+	poolStatsMu.Lock()
+	defer poolStatsMu.Unlock()
+
+	if poolStats != nil {
+		prometheus.Unregister(poolStats)
+	}
+
+	poolStats = collectors.NewDBStatsCollector(db, "n_users")
+	prometheus.MustRegister(poolStats)
+}
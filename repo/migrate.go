@@ -0,0 +1,23 @@
+package repo
+
+import (
+	"database/sql"
+	"embed"
+
+	"n_users/migration"
+)
+
+// migrationFiles holds the versioned schema of the profile database, see migration.Load for naming
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator creates migration.Migrator of the profile database schema
+func NewMigrator(db *sql.DB) (*migration.Migrator, error) {
+	migrations, err := migration.Load(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migration.New(db, migrations), nil
+}
@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	m, err := NewMigrator(nil)
+	if err != nil {
+		t.Fatalf("load migrations error %s", err)
+	}
+
+	for i, migration := range m.Migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d but expected %d", migration.Name, migration.Version, i+1)
+		}
+	}
+
+	// text search can use idx_profile_text only while both expressions are identical
+	found := false
+	for _, migration := range m.Migrations {
+		if strings.Contains(migration.Up, "idx_profile_text") {
+			found = strings.Contains(migration.Up, "(("+textDocumentSQL+")")
+		}
+	}
+
+	if !found {
+		t.Errorf("idx_profile_text migration does not index textDocumentSQL")
+	}
+}
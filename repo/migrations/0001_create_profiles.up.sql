@@ -0,0 +1,43 @@
+-- IF NOT EXISTS adopts databases created by gorm AutoMigrate before migrations existed
+CREATE TABLE IF NOT EXISTS profiles (
+    tenant_id text NOT NULL,
+    profile_id text NOT NULL,
+    full_name text,
+    gender text,
+    email_id text,
+    mobile text,
+    birth_date timestamp with time zone,
+    city_id text,
+    country_id text,
+    address text,
+    latitude numeric,
+    longitude numeric,
+    profile_image_url text,
+    profile_image_renditions jsonb,
+    profile_image_key text,
+    version bigint NOT NULL DEFAULT 1,
+    active boolean,
+    created_by text,
+    created_at timestamp with time zone,
+    updated_by text,
+    updated_at timestamp with time zone,
+    deleted_by text,
+    deleted_at timestamp with time zone,
+    CONSTRAINT profiles_pkey PRIMARY KEY (tenant_id, profile_id)
+);
+
+-- AutoMigrate did not create the primary key
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'profiles_pkey') THEN
+        ALTER TABLE profiles ADD CONSTRAINT profiles_pkey PRIMARY KEY (tenant_id, profile_id);
+    END IF;
+END $$;
+
+-- columns added to the profile after AutoMigrate created the table
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_image_renditions jsonb;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_image_key text;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_profile_location ON profiles (latitude, longitude);
+CREATE INDEX IF NOT EXISTS idx_profiles_profile_image_key ON profiles (profile_image_key);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_profile_tenant_email;
+DROP INDEX IF EXISTS idx_profile_tenant_mobile;
+
+ALTER TABLE profiles ADD CONSTRAINT profiles_email_id_key UNIQUE (email_id);
+ALTER TABLE profiles ADD CONSTRAINT profiles_mobile_key UNIQUE (mobile);
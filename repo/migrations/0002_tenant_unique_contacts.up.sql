@@ -0,0 +1,47 @@
+-- email and mobile used to be unique across tenants
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_email_id_key;
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_mobile_key;
+
+-- emails and mobiles were stored as typed before they were normalized, the functions
+-- follow validation.NormalizeEmail and validation.NormalizeMobile
+CREATE FUNCTION pg_temp.normalize_email(email text) RETURNS text AS $$
+    SELECT regexp_replace(lower(btrim(email, E' \t\n\r\f\v')), '\.$', '')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION pg_temp.normalize_mobile(mobile text) RETURNS text AS $$
+    SELECT CASE WHEN typed ~ '^\+?[0-9 .()-]*$' THEN regexp_replace(typed, '[ .()-]', '', 'g') ELSE typed END
+    FROM (SELECT regexp_replace(btrim(mobile, E' \t\n\r\f\v'), '^00', '+') AS typed) t
+$$ LANGUAGE sql IMMUTABLE;
+
+UPDATE profiles SET email_id = pg_temp.normalize_email(email_id) WHERE email_id <> pg_temp.normalize_email(email_id);
+UPDATE profiles SET mobile = pg_temp.normalize_mobile(mobile) WHERE mobile <> pg_temp.normalize_mobile(mobile);
+
+DROP FUNCTION pg_temp.normalize_email(text);
+DROP FUNCTION pg_temp.normalize_mobile(text);
+
+-- profiles that only differed in the typed form now collide, they have to be merged or deleted
+-- by hand. Failing here rolls the migration back and names them instead of a bare index error.
+DO $$
+DECLARE
+    collisions text;
+BEGIN
+    SELECT string_agg(format('tenant %s %s %s: profiles %s', tenant_id, field, value, profile_ids), E'\n')
+    INTO collisions
+    FROM (
+        SELECT tenant_id, 'email_id' AS field, email_id AS value, string_agg(profile_id, ', ' ORDER BY profile_id) AS profile_ids
+        FROM profiles WHERE deleted_at IS NULL AND email_id IS NOT NULL
+        GROUP BY tenant_id, email_id HAVING count(*) > 1
+        UNION ALL
+        SELECT tenant_id, 'mobile', mobile, string_agg(profile_id, ', ' ORDER BY profile_id)
+        FROM profiles WHERE deleted_at IS NULL AND mobile IS NOT NULL
+        GROUP BY tenant_id, mobile HAVING count(*) > 1
+    ) duplicates;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION E'profiles share an email or mobile within their tenant, merge or delete them before migrating:\n%', collisions;
+    END IF;
+END $$;
+
+-- soft deleted profiles release their email and mobile, they can be registered again
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profile_tenant_email ON profiles (tenant_id, email_id) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profile_tenant_mobile ON profiles (tenant_id, mobile) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_profile_text;
@@ -0,0 +1,6 @@
+-- pg_trgm ships with Postgres contrib and gives prefix and typo tolerant matching through word similarity.
+-- The indexed expression must stay identical to repo.textDocumentSQL, otherwise Postgres can not use it.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_profile_text ON profiles
+    USING gin ((lower(coalesce(full_name, '') || ' ' || coalesce(email_id, '') || ' ' || coalesce(address, ''))) gin_trgm_ops);
@@ -0,0 +1,2 @@
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_tenant_id_fkey;
+DROP TABLE IF EXISTS tenants;
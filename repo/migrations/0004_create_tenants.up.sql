@@ -0,0 +1,14 @@
+-- tenants used to be any value of the ntenant header, tenants owning profiles are registered as active
+CREATE TABLE tenants (
+    tenant_id text NOT NULL,
+    name text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'active',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT tenants_pkey PRIMARY KEY (tenant_id),
+    CONSTRAINT tenants_status_check CHECK (status IN ('active', 'suspended'))
+);
+
+INSERT INTO tenants (tenant_id) SELECT DISTINCT tenant_id FROM profiles;
+
+ALTER TABLE profiles ADD CONSTRAINT profiles_tenant_id_fkey FOREIGN KEY (tenant_id) REFERENCES tenants (tenant_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS profile_audit;
+DROP FUNCTION IF EXISTS profile_audit_append_only();
@@ -0,0 +1,28 @@
+-- audit trail of profile changes, written in the transaction of each change. Entries outlive purged profiles.
+CREATE TABLE profile_audit (
+    audit_id bigserial NOT NULL,
+    tenant_id text NOT NULL,
+    profile_id text NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    request_id text NOT NULL DEFAULT '',
+    version bigint NOT NULL DEFAULT 0,
+    changes jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT profile_audit_pkey PRIMARY KEY (audit_id)
+);
+
+CREATE INDEX idx_profile_audit_profile ON profile_audit (tenant_id, profile_id, audit_id DESC);
+
+-- entries are append only, the service role can not rewrite history
+CREATE FUNCTION profile_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'profile_audit is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER profile_audit_append_only BEFORE UPDATE OR DELETE ON profile_audit
+    FOR EACH ROW EXECUTE PROCEDURE profile_audit_append_only();
+
+CREATE TRIGGER profile_audit_no_truncate BEFORE TRUNCATE ON profile_audit
+    FOR EACH STATEMENT EXECUTE PROCEDURE profile_audit_append_only();
@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS redact_profile_audit(text, text);
+
+CREATE OR REPLACE FUNCTION profile_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'profile_audit is append only';
+END;
+$$ LANGUAGE plpgsql;
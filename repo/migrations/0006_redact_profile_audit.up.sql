@@ -0,0 +1,36 @@
+-- purging a profile erases the values its entries recorded, the entries themselves stay. Redaction runs
+-- through redact_profile_audit, a SECURITY DEFINER function owned by the migration owner, and only for
+-- profiles that no longer exist. The trigger lets an update through only when it runs as the table owner
+-- and nulls every recorded value of an entry without touching anything else.
+--
+-- Trade-off: the table owner can always disable the trigger, the trail is immutable only for roles that do
+-- not own it, so the service should connect with a role other than the migration owner. Any role may call
+-- the function, which only ever erases values of purged profiles, never rewrites or removes an entry.
+CREATE OR REPLACE FUNCTION profile_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    -- OLD is unassigned for truncation
+    IF TG_OP = 'UPDATE' THEN
+        IF current_user = (SELECT pg_get_userbyid(relowner) FROM pg_class WHERE oid = TG_RELID)
+            AND (NEW.audit_id, NEW.tenant_id, NEW.profile_id, NEW.action, NEW.actor, NEW.request_id, NEW.version, NEW.created_at)
+                IS NOT DISTINCT FROM (OLD.audit_id, OLD.tenant_id, OLD.profile_id, OLD.action, OLD.actor, OLD.request_id, OLD.version, OLD.created_at)
+            AND NEW.changes = (SELECT jsonb_object_agg(key, '{"before": null, "after": null}'::jsonb) FROM jsonb_each(OLD.changes))
+        THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+
+    RAISE EXCEPTION 'profile_audit is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION redact_profile_audit(tenant text, profile text) RETURNS void AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM profiles WHERE tenant_id = tenant AND profile_id = profile) THEN
+        RAISE EXCEPTION 'profile % of tenant % must be purged before its audit trail is redacted', profile, tenant;
+    END IF;
+
+    UPDATE profile_audit
+    SET changes = (SELECT jsonb_object_agg(key, '{"before": null, "after": null}'::jsonb) FROM jsonb_each(changes))
+    WHERE tenant_id = tenant AND profile_id = profile AND changes <> '{}';
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path FROM CURRENT;
@@ -0,0 +1,312 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"n_users/auth"
+	"n_users/entity"
+
+	"github.com/jinzhu/gorm"
+)
+
+// postgresDB opens an empty schema of the database at TEST_DATABASE_URL, dropped when the test ends.
+// Tests needing Postgres are skipped when it is not set.
+func postgresDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a postgres:// url, %s", err)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("n_users_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+
+	// public stays on the path for extensions installed there
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+
+	db, err := gorm.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	return db
+}
+
+// migrate applies every migration to db
+func migrate(t *testing.T, db *gorm.DB) {
+	m, err := NewMigrator(db.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("migrate up error %s", err)
+	}
+}
+
+func TestDeletedProfileReleasesEmailAndMobile(t *testing.T) {
+	db := postgresDB(t)
+	migrate(t, db)
+
+	if err := db.Exec("INSERT INTO tenants (tenant_id) VALUES ('acme')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	pr := newProfileRepo(db)
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "admin"})
+	profile := entity.Profile{ProfileID: "201", TenantID: "acme", FullName: "Nimesh", EmailID: "nimesh@example.com", Mobile: "+14155550123"}
+	again := profile
+	again.ProfileID = "202"
+
+	if _, err := pr.Create(ctx, profile); err != nil {
+		t.Fatalf("create error %s", err)
+	}
+
+	if _, err := pr.Create(ctx, again); entity.AsDomainError(err).Kind != entity.KindConflict {
+		t.Fatalf("create with email and mobile of a live profile gave %v but expected conflict", err)
+	}
+
+	if _, err := pr.Delete(ctx, "201", "acme", 0); err != nil {
+		t.Fatalf("delete error %s", err)
+	}
+
+	if _, err := pr.Create(ctx, again); err != nil {
+		t.Fatalf("create with email and mobile of a deleted profile error %s", err)
+	}
+
+	// the deleted profile can no longer come back with contacts now used by another profile
+	if _, err := pr.Restore(ctx, "201", "acme"); entity.AsDomainError(err).Kind != entity.KindConflict {
+		t.Errorf("restore of profile whose contacts were registered again gave %v but expected conflict", err)
+	}
+}
+
+func TestCursorPagesPastNullSortValues(t *testing.T) {
+	db := postgresDB(t)
+	migrate(t, db)
+
+	if err := db.Exec("INSERT INTO tenants (tenant_id) VALUES ('acme')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	pr := newProfileRepo(db)
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "admin"})
+
+	for i, id := range []string{"201", "202", "203"} {
+		p := entity.Profile{ProfileID: id, TenantID: "acme", FullName: "Nimesh", EmailID: id + "@example.com", Mobile: fmt.Sprintf("+1415555012%d", i)}
+		if _, err := pr.Create(ctx, p); err != nil {
+			t.Fatalf("create error %s", err)
+		}
+	}
+	if _, err := pr.Delete(ctx, "202", "acme", 0); err != nil {
+		t.Fatalf("delete error %s", err)
+	}
+
+	// profiles never deleted sort last either way, ordered by profile_id in the same direction
+	for direction, expected := range map[string]string{"asc": "202 201 203", "desc": "202 203 201"} {
+		request := entity.SearchProfileRequest{SortBy: "deleted_at " + direction, IncludeDeleted: true, Pagination: "cursor", Limit: 1}
+
+		var ids []string
+		for page := 0; page < 5; page++ {
+			res, err := pr.Search(ctx, request, "acme")
+			if err != nil {
+				t.Fatalf("search error %s", err)
+			}
+			for _, p := range res.Items {
+				ids = append(ids, p.ProfileID)
+			}
+			if len(res.NextCursor) == 0 {
+				break
+			}
+			request.Cursor = res.NextCursor
+		}
+
+		if strings.Join(ids, " ") != expected {
+			t.Errorf("pages sorted by deleted_at %s are %v but expected %s", direction, ids, expected)
+		}
+	}
+}
+
+func TestPurgeRedactsAuditTrail(t *testing.T) {
+	db := postgresDB(t)
+	migrate(t, db)
+
+	if err := db.Exec("INSERT INTO tenants (tenant_id) VALUES ('acme')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	pr := newProfileRepo(db)
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "admin"})
+
+	for _, p := range []entity.Profile{
+		{ProfileID: "201", TenantID: "acme", FullName: "Nimesh", EmailID: "nimesh@example.com", Mobile: "+14155550123"},
+		{ProfileID: "202", TenantID: "acme", FullName: "Kavya", EmailID: "kavya@example.com", Mobile: "+14155550124"},
+	} {
+		if _, err := pr.Create(ctx, p); err != nil {
+			t.Fatalf("create error %s", err)
+		}
+	}
+
+	// the trail can not be rewritten outside a purge
+	if err := db.Exec("UPDATE profile_audit SET changes = '{}'").Error; err == nil || !strings.Contains(err.Error(), "append only") {
+		t.Fatalf("rewrite of the audit trail gave %v but expected the append only trigger", err)
+	}
+
+	// only trails of purged profiles are redacted
+	if err := db.Exec("SELECT redact_profile_audit('acme', '202')").Error; err == nil || !strings.Contains(err.Error(), "must be purged") {
+		t.Fatalf("redaction of a live profile gave %v but expected it to be refused", err)
+	}
+
+	if _, err := pr.Purge(ctx, "201", "acme"); err != nil {
+		t.Fatalf("purge error %s", err)
+	}
+
+	history, err := pr.History(ctx, "201", "acme", 10, "")
+	if err != nil || len(history.Items) != 2 {
+		t.Fatalf("history of purged profile is %+v, %v", history, err)
+	}
+
+	created := history.Items[1].Changes
+	if c, ok := created["email_id"]; !ok || c.Before != nil || c.After != nil {
+		t.Errorf("create entry of purged profile still records %+v", created)
+	}
+
+	// entries of other profiles keep their values
+	history, err = pr.History(ctx, "202", "acme", 10, "")
+	if err != nil || len(history.Items) != 1 || history.Items[0].Changes["email_id"].After != "kavya@example.com" {
+		t.Errorf("history of another profile is %+v, %v", history, err)
+	}
+}
+
+// baselineProfile is the profile as gorm AutoMigrate created its table before migrations existed
+type baselineProfile struct {
+	TenantID        string `gorm:"primaryKey"`
+	ProfileID       string `gorm:"primaryKey"`
+	FullName        string
+	Gender          string
+	EmailID         string `gorm:"unique"`
+	Mobile          string `gorm:"unique"`
+	BirthDate       time.Time
+	CityID          string
+	CountryID       string
+	Address         string
+	Latitude        float64
+	Longitude       float64
+	ProfileImageURL string
+	Active          bool
+	CreatedBy       string
+	CreatedAt       time.Time
+	UpdatedBy       string
+	UpdatedAt       time.Time
+	DeletedBy       string
+	DeletedAt       *time.Time
+}
+
+func (baselineProfile) TableName() string {
+	return "profiles"
+}
+
+func TestMigrateUpFromAutoMigrateSchema(t *testing.T) {
+	db := postgresDB(t)
+
+	if err := db.AutoMigrate(&baselineProfile{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := baselineProfile{TenantID: "acme", ProfileID: "101", FullName: "Legacy", EmailID: "legacy@example.com", Mobile: "+14155550100", Active: true}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrate(t, db)
+
+	pr := newProfileRepo(db)
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "admin"})
+
+	profile, err := pr.Get(ctx, "101", "acme")
+	if err != nil || profile.Version != 1 {
+		t.Fatalf("legacy profile read as version %d, %v but expected version 1", profile.Version, err)
+	}
+
+	filters := map[string]interface{}{"profile_id": "101", "tenant_id": "acme", "version": int64(1)}
+	if version, err := pr.Update(ctx, filters, map[string]interface{}{"profile_image_key": "img"}); err != nil || version != 2 {
+		t.Errorf("versioned update of legacy profile gave version %d, %v but expected 2", version, err)
+	}
+}
+
+func TestMigrateUpNormalizesLegacyContacts(t *testing.T) {
+	db := postgresDB(t)
+
+	if err := db.AutoMigrate(&baselineProfile{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := []baselineProfile{
+		{TenantID: "acme", ProfileID: "101", EmailID: "Nimesh@Example.com ", Mobile: "0091 88888-00000"},
+		{TenantID: "acme", ProfileID: "102", EmailID: "nimesh@example.com", Mobile: "+918888800001"},
+		{TenantID: "acme", ProfileID: "103", EmailID: "other@example.com", Mobile: "+91 (888) 8800001"},
+	}
+	for _, p := range legacy {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewMigrator(db.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Up()
+	if err == nil {
+		t.Fatalf("migrate up accepted profiles sharing an email and a mobile")
+	}
+
+	for _, collision := range []string{"email_id nimesh@example.com: profiles 101, 102", "mobile +918888800001: profiles 102, 103"} {
+		if !strings.Contains(err.Error(), collision) {
+			t.Errorf("migrate up error %q does not report %s", err, collision)
+		}
+	}
+
+	// merging the profiles lets the migration complete
+	if err := db.Exec("DELETE FROM profiles WHERE profile_id = '102'").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("migrate up error %s", err)
+	}
+
+	var mobiles []string
+	db.Table("profiles").Order("profile_id").Pluck("mobile", &mobiles)
+	if expected := []string{"+918888800000", "+918888800001"}; !reflect.DeepEqual(mobiles, expected) {
+		t.Errorf("mobiles are %v after migration but expected %v", mobiles, expected)
+	}
+}
@@ -1,8 +1,14 @@
 package repo
 
 import (
+	"context"
 	"errors"
+	"n_users/audit"
+	"n_users/auth"
+	"n_users/config"
 	"n_users/entity"
+	"n_users/tracing"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -13,11 +19,20 @@ import (
 
 // ProfileRepo represent interface to perform CRUD on database
 type ProfileRepo interface {
-	Create(profile entity.Profile) (string, error)
-	Delete(profileID string, tenantID string) (bool, error)
-	Search(query string, limit int, offset int, sortBy string, tenantID string) ([]entity.Profile, error)
-	Update(filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (bool, error)
-	UploadProfileImage(profileID string, image []byte) (bool, error)
+	Create(ctx context.Context, profile entity.Profile) (string, error)
+	Delete(ctx context.Context, profileID string, tenantID string, version int64) (bool, error)
+	Restore(ctx context.Context, profileID string, tenantID string) (bool, error)
+	Purge(ctx context.Context, profileID string, tenantID string) (entity.Profile, error)
+	Get(ctx context.Context, profileID string, tenantID string) (entity.Profile, error)
+	Search(ctx context.Context, request entity.SearchProfileRequest, tenantID string) (entity.SearchProfileResponse, error)
+	Update(ctx context.Context, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (int64, error)
+	// ImageKeysInUse reports which image keys are referenced by profiles that are live or were soft deleted after deletedBefore
+	ImageKeysInUse(ctx context.Context, keys []string, deletedBefore time.Time) (map[string]bool, error)
+	// History returns a page of the audit trail of the profile after the cursor, newest entries first
+	History(ctx context.Context, profileID string, tenantID string, limit int, cursor string) (entity.ProfileHistory, error)
+	// GetTenant returns the tenant registry entry, ErrTenantNotFound when it is not registered
+	GetTenant(ctx context.Context, tenantID string) (entity.Tenant, error)
+	Ping(ctx context.Context) error
 	SafeClose()
 }
 
@@ -26,72 +41,437 @@ type profileRepo struct {
 }
 
 // New creates new object of ProfileRepo
-func New(dialect string, dbName string) (ProfileRepo, error) {
-	db, err := gorm.Open(dialect, dbName)
+func New(dialect string, cfg config.DatabaseConfig) (ProfileRepo, error) {
+	db, err := gorm.Open(dialect, string(cfg.URL))
 
 	if err != nil {
 		zap.L().Fatal("failed to connect database", zap.Error(err))
 		return nil, err
 	}
 
-	db.DB().SetMaxIdleConns(5)
-	db.DB().SetMaxOpenConns(100)
-	db.LogMode(true)
+	db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
+	db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	db.LogMode(cfg.LogQueries)
 	//db.SetLogger(zap.L()) TODO: fix this
 
-	// Migrate the schema
-	db.AutoMigrate(&entity.Profile{})
+	// schema is changed only by migrate command, never by a serving instance
+	m, err := NewMigrator(db.DB())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := m.Check(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	registerPoolStats(db.DB())
 
 	defer zap.L().Info("sql database setup completed")
-	return &profileRepo{DB: db}, nil
+	return newProfileRepo(db), nil
+}
+
+// newProfileRepo registers query callbacks on the own copy of gorm.DefaultCallback of db,
+// which its transactions share. Other handles opened in the process are left alone.
+func newProfileRepo(db *gorm.DB) *profileRepo {
+	callbacks := db.Callback()
+	registerTracing(callbacks)
+	registerWho(callbacks)
+	return &profileRepo{DB: db}
+}
+
+// Ping checks that the database accepts connections
+func (pr *profileRepo) Ping(ctx context.Context) error {
+	return pr.DB.DB().PingContext(ctx)
 }
 
 func (pr *profileRepo) SafeClose() {
 	pr.DB.Close()
 }
 
-func (pr *profileRepo) Create(profile entity.Profile) (string, error) {
-	res := pr.DB.Create(profile)
-	if res.Error != nil {
-		zap.L().Error(res.Error.Error())
-		return "", res.Error
+func (pr *profileRepo) Create(ctx context.Context, profile entity.Profile) (_ string, err error) {
+	defer observeQuery("create", time.Now(), &err)
+
+	// set explicitly so that the audit entry records it
+	if profile.Version == 0 {
+		profile.Version = 1
+	}
+
+	err = pr.transaction(ctx, func(tx *gorm.DB) error {
+		// a pointer lets callbacks fill timestamps and who columns
+		if err := tx.Create(&profile).Error; err != nil {
+			return err
+		}
+
+		return record(ctx, tx, entity.AuditCreate, profile, changes(tx, nil, &profile))
+	})
+
+	if err != nil {
+		tracing.Logger(ctx).Error(err.Error())
+		return "", dbError(err)
 	}
 
 	return profile.ProfileID, nil
 }
 
-func (pr *profileRepo) Delete(profileID string, tenantID string) (bool, error) {
+// live returns query of db over profiles that are not soft deleted. Soft delete is handled
+// explicitly through deleted_at instead of relying on gorm's DeletedAt convention.
+func live(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NULL")
+}
+
+// Delete soft deletes the profile, it can be brought back with Restore.
+// When version is not zero the profile is deleted only if it still has that version.
+func (pr *profileRepo) Delete(ctx context.Context, profileID string, tenantID string, version int64) (_ bool, err error) {
+	defer observeQuery("delete", time.Now(), &err)
+
+	filters := map[string]interface{}{"profile_id": profileID, "tenant_id": tenantID}
+	if version != 0 {
+		filters["version"] = version
+	}
+
+	newVersion, err := pr.update(ctx, entity.AuditDelete, filters, map[string]interface{}{
+		"active":     false,
+		"deleted_at": time.Now(),
+		"deleted_by": auth.Actor(ctx),
+	})
+
+	return newVersion > 0, err
+}
+
+// Restore undoes soft delete of the profile
+func (pr *profileRepo) Restore(ctx context.Context, profileID string, tenantID string) (bool, error) {
+	restored := false
+
+	err := pr.transaction(ctx, func(tx *gorm.DB) error {
+		var before entity.Profile
+		res := tx.Unscoped().
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("profile_id = ? AND tenant_id = ? AND deleted_at IS NOT NULL", profileID, tenantID).
+			First(&before)
+
+		if res.RecordNotFound() {
+			return nil
+		}
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		err := tx.Unscoped().
+			Model(&entity.Profile{}).
+			Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).
+			Updates(map[string]interface{}{
+				"active":     true,
+				"deleted_at": gorm.Expr("NULL"),
+				"deleted_by": "",
+				"version":    gorm.Expr("version + 1"),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		after, err := reload(tx, profileID, tenantID)
+		if err != nil {
+			return err
+		}
+
+		restored = true
+		return record(ctx, tx, entity.AuditRestore, after, changes(tx, &before, &after))
+	})
+
+	if err != nil {
+		tracing.Logger(ctx).Error(err.Error())
+		return false, dbError(err)
+	}
+
+	return restored, nil
+}
+
+// Purge permanently removes the profile, deleted or not, and returns the removed row
+func (pr *profileRepo) Purge(ctx context.Context, profileID string, tenantID string) (entity.Profile, error) {
 	var profile entity.Profile
-	res := pr.DB.Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).Delete(&profile)
 
-	if res.Error != nil {
-		zap.L().Error(res.Error.Error())
-		return false, res.Error
+	err := pr.transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Unscoped().
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).
+			First(&profile)
+
+		if res.RecordNotFound() {
+			return ErrNotFound
+		}
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		err := tx.Unscoped().
+			Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).
+			Delete(&entity.Profile{}).Error
+		if err != nil {
+			return err
+		}
+
+		// values of a purged profile are erased from earlier entries as well, the entry of the
+		// purge only records who purged it
+		if err := redact(tx, profileID, tenantID); err != nil {
+			return err
+		}
+
+		return record(ctx, tx, entity.AuditPurge, profile, nil)
+	})
+
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			tracing.Logger(ctx).Error(err.Error())
+			err = dbError(err)
+		}
+		return entity.Profile{}, err
 	}
 
-	return res.RowsAffected > 0, nil
+	return profile, nil
 }
 
-func (pr *profileRepo) Search(query string, limit int, offset int, sortBy string, tenantID string) ([]entity.Profile, error) {
+func (pr *profileRepo) Get(ctx context.Context, profileID string, tenantID string) (entity.Profile, error) {
+	var profile entity.Profile
+	err := pr.read(ctx, func(db *gorm.DB) error {
+		res := live(db).Where("profile_id = ? AND tenant_id = ?", profileID, tenantID).First(&profile)
+		if res.RecordNotFound() {
+			return ErrNotFound
+		}
+		return res.Error
+	})
+
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			tracing.Logger(ctx).Error(err.Error())
+			err = dbError(err)
+		}
+		return entity.Profile{}, err
+	}
+
+	return profile, nil
+}
+
+func (pr *profileRepo) Search(ctx context.Context, request entity.SearchProfileRequest, tenantID string) (_ entity.SearchProfileResponse, err error) {
+	defer observeQuery("search", time.Now(), &err)
+
+	// offset pages are served as a plain list, a total would be counted only to be discarded
+	if request.IncludeTotal && !request.CursorMode() {
+		return entity.SearchProfileResponse{}, filterErrorf("include_total requires cursor pagination")
+	}
+
+	where, args, err := compileFilter(request.Filter)
+	if err != nil {
+		return entity.SearchProfileResponse{}, err
+	}
+
+	g, err := compileGeo(request.Geo)
+	if err != nil {
+		return entity.SearchProfileResponse{}, err
+	}
+
+	t, err := compileText(request.Text)
+	if err != nil {
+		return entity.SearchProfileResponse{}, err
+	}
+
+	if g != nil && t != nil {
+		return entity.SearchProfileResponse{}, filterErrorf("geo and text search can not be combined")
+	}
+
+	key, err := searchSortKey(request, g, t)
+	if err != nil {
+		return entity.SearchProfileResponse{}, err
+	}
+
+	var after *cursor
+	if request.CursorMode() && len(request.Cursor) > 0 {
+		c, err := decodeCursor(request.Cursor)
+		if err != nil {
+			return entity.SearchProfileResponse{}, err
+		}
+
+		if c.Column != key.Name || c.Direction != key.Direction {
+			return entity.SearchProfileResponse{}, filterErrorf("cursor was issued for sort_by %q", c.Column+" "+c.Direction)
+		}
+		after = &c
+	}
+
+	var page entity.SearchProfileResponse
+	limit := pageSize(int(request.Limit))
+
+	err = pr.read(ctx, func(db *gorm.DB) error {
+		db = db.Unscoped().Model(&entity.Profile{}).Where("tenant_id = ?", tenantID)
+		if !request.IncludeDeleted {
+			db = db.Where("deleted_at IS NULL")
+		}
+		if len(where) > 0 {
+			db = db.Where(where, args...)
+		}
+		if g != nil {
+			condition, values := g.condition()
+			db = db.Where(condition, values...)
+		}
+		if t != nil {
+			condition, values := t.condition()
+			db = db.Where(condition, values...)
+		}
+
+		if request.IncludeTotal {
+			var total int64
+			if err := db.Count(&total).Error; err != nil {
+				return err
+			}
+			page.TotalCount = &total
+		}
+
+		if key != nil {
+			for _, order := range key.orderBy() {
+				db = db.Order(order)
+			}
+		}
+
+		if !request.CursorMode() {
+			items, err := find(db.Limit(int(request.Limit)).Offset(int(request.Offset)), g, t)
+			page.Items = items
+			return err
+		}
+
+		if after != nil {
+			condition, values := keysetCondition(*after, *key)
+			db = db.Where(condition, values...)
+		}
+
+		// fetch one extra row to find out whether another page exists
+		items, err := find(db.Limit(limit+1), g, t)
+		page.Items = items
+		return err
+	})
+
+	if err != nil {
+		tracing.Logger(ctx).Error(err.Error())
+		return entity.SearchProfileResponse{}, dbError(err)
+	}
+
+	if !request.CursorMode() {
+		return page, nil
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+
+		c := cursor{Column: key.Name, Direction: key.Direction, ProfileID: last.ProfileID}
+		switch {
+		case g != nil:
+			c.Value = *last.DistanceKM
+		case t != nil:
+			c.Value = *last.Score
+		case key.Name != "profile_id":
+			c.Value = columnValue(last, key.Name)
+		}
+		page.NextCursor = encodeCursor(c)
+	}
+
+	return page, nil
+}
+
+// searchRow is a profile together with its distance or text search score computed by the query
+type searchRow struct {
+	entity.Profile
+	SearchDistance float64
+	SearchScore    float64
+}
+
+// find runs search query and fills distance or score of every profile. Both are read from the
+// query, so that cursors carry exactly the value the keyset condition compares against.
+func find(db *gorm.DB, g *geoSearch, t *textSearch) ([]entity.Profile, error) {
 	var profiles []entity.Profile
 
-	res := pr.DB.Where(query).
-		Where("tenant_id = ?", tenantID).
-		Limit(limit).
-		Offset(offset).
-		Order(sortBy).
-		Find(&profiles)
+	if g == nil && t == nil {
+		if err := db.Find(&profiles).Error; err != nil {
+			return nil, err
+		}
+
+		return profiles, nil
+	}
+
+	if g != nil {
+		db = db.Select("profiles.*, "+distanceSQL+" AS search_distance", g.distanceArgs()...)
+	} else {
+		score, args := t.score()
+		db = db.Select("profiles.*, "+score+" AS search_score", args...)
+	}
+
+	var rows []searchRow
+	if err := db.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
 
-	if res.Error != nil {
-		zap.L().Error(res.Error.Error())
-		return nil, res.Error
+	profiles = make([]entity.Profile, 0, len(rows))
+	for _, row := range rows {
+		p := row.Profile
+		if g != nil {
+			distance := row.SearchDistance
+			p.DistanceKM = &distance
+		} else {
+			score := row.SearchScore
+			p.Score = &score
+		}
+		profiles = append(profiles, p)
 	}
 
 	return profiles, nil
 }
 
-func (pr *profileRepo) Update(filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (bool, error) {
+// searchSortKey returns ordering of search results, nil when results need no particular order
+func searchSortKey(request entity.SearchProfileRequest, g *geoSearch, t *textSearch) (*sortKey, error) {
+	if t != nil {
+		if len(request.SortBy) > 0 {
+			return nil, filterErrorf("text search results are always sorted by relevance, remove sort_by")
+		}
+		score, args := t.score()
+		return &sortKey{Name: "score", SQL: score, Args: args, Direction: "DESC"}, nil
+	}
 
+	if g != nil {
+		if len(request.SortBy) > 0 {
+			return nil, filterErrorf("geo search results are always sorted by distance, remove sort_by")
+		}
+		return &sortKey{Name: "distance", SQL: distanceSQL, Args: g.distanceArgs(), Direction: "ASC"}, nil
+	}
+
+	column, direction, err := parseSort(request.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(column) == 0 {
+		if !request.CursorMode() {
+			return nil, nil
+		}
+		column, direction = "profile_id", "ASC"
+	}
+
+	// every column but the primary key may hold NULL, e.g. deleted_at of live profiles
+	return &sortKey{Name: column, SQL: column, Direction: direction, Nullable: column != "profile_id"}, nil
+}
+
+// Update changes fields of the profile matching filters and returns its new version, zero when
+// no profile matched. When filters contain "version" the version is checked by the UPDATE
+// statement itself and ErrVersionMismatch is returned if the profile has moved on. The change
+// is recorded in the audit trail as the action of ctx, update by default.
+func (pr *profileRepo) Update(ctx context.Context, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (_ int64, err error) {
+	defer observeQuery("update", time.Now(), &err)
+
+	return pr.update(ctx, audit.Action(ctx, entity.AuditUpdate), filters, fieldsToUpdate)
+}
+
+// update changes fields of the profile and records the change as action in the audit trail
+func (pr *profileRepo) update(ctx context.Context, action string, filters map[string]interface{}, fieldsToUpdate map[string]interface{}) (int64, error) {
 	profile := entity.Profile{}
 
 	if value, ok := filters["profile_id"]; ok {
@@ -102,19 +482,93 @@ func (pr *profileRepo) Update(filters map[string]interface{}, fieldsToUpdate map
 		profile.TenantID = value.(string)
 	}
 
-	res := pr.DB.
-		Model(&profile).
-		Where("profile_id = ? and tenant_id = ?", profile.ProfileID, profile.TenantID).
-		Updates(fieldsToUpdate)
+	fields := make(map[string]interface{}, len(fieldsToUpdate)+1)
+	for k, v := range fieldsToUpdate {
+		fields[k] = v
+	}
+	fields["version"] = gorm.Expr("version + 1")
+
+	var newVersion int64
+
+	err := pr.transaction(ctx, func(tx *gorm.DB) error {
+		// the lock keeps the row as read until the audit entry is written
+		var before entity.Profile
+		res := tx.Unscoped().
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("deleted_at IS NULL").
+			Where("profile_id = ? and tenant_id = ?", profile.ProfileID, profile.TenantID).
+			First(&before)
+
+		if res.RecordNotFound() {
+			return nil
+		}
 
-	if res.Error != nil {
-		zap.L().Error(res.Error.Error())
-		return false, res.Error
+		if res.Error != nil {
+			return res.Error
+		}
+
+		db := tx.Unscoped().
+			Model(&profile).
+			Where("profile_id = ? and tenant_id = ?", profile.ProfileID, profile.TenantID)
+
+		if version, ok := filters["version"]; ok {
+			db = db.Where("version = ?", version)
+		}
+
+		res = db.Updates(fields)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		// the locked profile exists, only a stale version matches nothing
+		if res.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		after, err := reload(tx, profile.ProfileID, profile.TenantID)
+		if err != nil {
+			return err
+		}
+
+		newVersion = after.Version
+		return record(ctx, tx, action, after, changes(tx, &before, &after))
+	})
+
+	if err != nil {
+		if !errors.Is(err, ErrVersionMismatch) {
+			tracing.Logger(ctx).Error(err.Error())
+			err = dbError(err)
+		}
+		return 0, err
 	}
 
-	return res.RowsAffected > 0, nil
+	return newVersion, nil
 }
 
-func (pr *profileRepo) UploadProfileImage(profileID string, image []byte) (bool, error) {
-	return false, errors.New("not implemented")
+// ImageKeysInUse reports which of the image keys are referenced by a profile of any tenant. Profiles
+// soft deleted before deletedBefore no longer hold on to their images.
+func (pr *profileRepo) ImageKeysInUse(ctx context.Context, keys []string, deletedBefore time.Time) (map[string]bool, error) {
+	inUse := map[string]bool{}
+	if len(keys) == 0 {
+		return inUse, nil
+	}
+
+	var used []string
+	err := pr.read(ctx, func(db *gorm.DB) error {
+		// recently soft deleted profiles keep their images so that they can be restored
+		return db.Unscoped().Model(&entity.Profile{}).
+			Where("profile_image_key IN (?) AND (deleted_at IS NULL OR deleted_at > ?)", keys, deletedBefore).
+			Pluck("profile_image_key", &used).Error
+	})
+
+	if err != nil {
+		tracing.Logger(ctx).Error(err.Error())
+		return nil, dbError(err)
+	}
+
+	for _, key := range used {
+		inUse[key] = true
+	}
+
+	return inUse, nil
 }
@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"context"
+	"errors"
+
+	"n_users/entity"
+	"n_users/tracing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrTenantNotFound is returned when the tenant is not registered
+var ErrTenantNotFound = entity.NewDomainError(entity.KindNotFound, "tenant_not_found", "tenant not found")
+
+// GetTenant returns the registry entry of the tenant
+func (pr *profileRepo) GetTenant(ctx context.Context, tenantID string) (entity.Tenant, error) {
+	var tenant entity.Tenant
+	err := pr.read(ctx, func(db *gorm.DB) error {
+		res := db.Where("tenant_id = ?", tenantID).First(&tenant)
+		if res.RecordNotFound() {
+			return ErrTenantNotFound
+		}
+		return res.Error
+	})
+
+	if err != nil {
+		if !errors.Is(err, ErrTenantNotFound) {
+			tracing.Logger(ctx).Error(err.Error())
+			err = dbError(err)
+		}
+		return entity.Tenant{}, err
+	}
+
+	return tenant, nil
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"n_users/entity"
+)
+
+const maxTextTokens = 8
+const maxTextQueryLength = 256
+
+// textDocumentSQL is the searchable text of a profile. It must stay identical to the
+// expression of idx_profile_text in migrations, otherwise Postgres can not use the trigram index.
+const textDocumentSQL = "lower(coalesce(full_name, '') || ' ' || coalesce(email_id, '') || ' ' || coalesce(address, ''))"
+
+// textSearch holds the compiled parts of a full text search
+type textSearch struct {
+	Tokens []string
+}
+
+func compileText(q *entity.TextQuery) (*textSearch, error) {
+	if q == nil {
+		return nil, nil
+	}
+
+	if len(q.Query) > maxTextQueryLength {
+		return nil, filterErrorf("text query must be at most %d characters", maxTextQueryLength)
+	}
+
+	tokens := tokenize(q.Query)
+	if len(tokens) == 0 {
+		return nil, filterErrorf("text query must contain at least one letter or digit")
+	}
+
+	if len(tokens) > maxTextTokens {
+		return nil, filterErrorf("text query must contain at most %d words", maxTextTokens)
+	}
+
+	return &textSearch{Tokens: tokens}, nil
+}
+
+// condition returns the SQL matching profiles that contain every token.
+// The <% operator matches when a word of the document is similar to the token,
+// which covers exact words, prefixes and small typos.
+func (t *textSearch) condition() (string, []interface{}) {
+	parts := make([]string, 0, len(t.Tokens))
+	args := make([]interface{}, 0, len(t.Tokens))
+
+	for _, token := range t.Tokens {
+		parts = append(parts, "? <% "+textDocumentSQL)
+		args = append(args, token)
+	}
+
+	return strings.Join(parts, " AND "), args
+}
+
+// score returns SQL ranking matches between 0 and 1, average word similarity of the tokens
+func (t *textSearch) score() (string, []interface{}) {
+	parts := make([]string, 0, len(t.Tokens))
+	args := make([]interface{}, 0, len(t.Tokens))
+
+	for _, token := range t.Tokens {
+		parts = append(parts, "word_similarity(?, "+textDocumentSQL+")")
+		args = append(args, token)
+	}
+
+	return "((" + strings.Join(parts, " + ") + ")::float8 / " + strconv.Itoa(len(parts)) + ")", args
+}
+
+// tokenize splits text into distinct lower case words
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := map[string]bool{}
+	tokens := []string{}
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			tokens = append(tokens, w)
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"n_users/entity"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("  Nimesh MITTAL, nimesh@gmail.com ")
+	expected := []string{"nimesh", "mittal", "gmail", "com"}
+
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("tokens are %v but expected %v", tokens, expected)
+	}
+}
+
+func TestCompileText(t *testing.T) {
+	ts, err := compileText(&entity.TextQuery{Query: "nimsh mit"})
+	if err != nil {
+		t.Fatalf("compile text error %s", err)
+	}
+
+	sql, args := ts.condition()
+	if strings.Count(sql, "<%") != 2 || !reflect.DeepEqual(args, []interface{}{"nimsh", "mit"}) {
+		t.Errorf("text condition is %s %v", sql, args)
+	}
+
+	score, args := ts.score()
+	if !strings.HasSuffix(score, "/ 2)") || len(args) != 2 {
+		t.Errorf("text score is %s %v", score, args)
+	}
+
+	for _, q := range []string{"", " ,.- ", "one two three four five six seven eight nine"} {
+		if _, err := compileText(&entity.TextQuery{Query: q}); err == nil {
+			t.Errorf("text query %q compiled without validation error", q)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"context"
+
+	"n_users/tracing"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "n_users:context"
+	spanKey    = "n_users:span"
+)
+
+// registerTracing starts a span around every query run with callbacks
+func registerTracing(callbacks *gorm.Callback) {
+	callbacks.Create().Before("gorm:create").Register("tracing:before_create", startSpan("INSERT"))
+	callbacks.Create().After("gorm:create").Register("tracing:after_create", endSpan)
+	callbacks.Query().Before("gorm:query").Register("tracing:before_query", startSpan("SELECT"))
+	callbacks.Query().After("gorm:query").Register("tracing:after_query", endSpan)
+	callbacks.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", startSpan("SELECT"))
+	callbacks.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", endSpan)
+	callbacks.Update().Before("gorm:update").Register("tracing:before_update", startSpan("UPDATE"))
+	callbacks.Update().After("gorm:update").Register("tracing:after_update", endSpan)
+	callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan("DELETE"))
+	callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan)
+}
+
+func startSpan(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+
+		ctx, _ := value.(context.Context)
+		if ctx == nil {
+			return
+		}
+
+		table := scope.TableName()
+		_, span := tracing.Start(ctx, operation+" "+table,
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.sql.table", table))
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+// endSpan records the statement, sql is known only after gorm built it
+func endSpan(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+
+	span := value.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.statement", tracing.SanitizeSQL(scope.SQL)),
+		attribute.Int64("db.rows_affected", scope.DB().RowsAffected))
+
+	err := scope.DB().Error
+	if gorm.IsRecordNotFoundError(err) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+
+	"n_users/auth"
+
+	"github.com/jinzhu/gorm"
+)
+
+// registerWho stamps who columns of every insert and update run with callbacks with the actor
+// of the query context, so that no write path can forget them
+func registerWho(callbacks *gorm.Callback) {
+	callbacks.Create().Before("gorm:create").Register("who:create", stampCreate)
+	callbacks.Update().Before("gorm:update").Register("who:update", stampUpdate)
+}
+
+// actor returns the actor of the context the query was started with
+func actor(scope *gorm.Scope) string {
+	value, _ := scope.Get(contextKey)
+	ctx, _ := value.(context.Context)
+	if ctx == nil {
+		return auth.UnknownActor
+	}
+	return auth.Actor(ctx)
+}
+
+func stampCreate(scope *gorm.Scope) {
+	if scope.HasError() {
+		return
+	}
+
+	who := actor(scope)
+	for _, name := range []string{"CreatedBy", "UpdatedBy"} {
+		if field, ok := scope.FieldByName(name); ok && field.IsBlank {
+			field.Set(who)
+		}
+	}
+}
+
+func stampUpdate(scope *gorm.Scope) {
+	// UpdateColumn skips hooks and timestamps, it skips who columns as well
+	if _, ok := scope.Get("gorm:update_column"); ok || scope.HasError() {
+		return
+	}
+
+	if _, ok := scope.FieldByName("UpdatedBy"); ok {
+		scope.SetColumn("UpdatedBy", actor(scope))
+	}
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"n_users/auth"
+	"n_users/entity"
+
+	"github.com/jinzhu/gorm"
+)
+
+// noDB satisfies gorm.SQLCommon, callbacks under test never reach the database
+type noDB struct {
+	gorm.SQLCommon
+}
+
+func TestWhoColumnsAreStampedWithActor(t *testing.T) {
+	db, err := gorm.Open("postgres", noDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "user-1"})
+
+	profile := entity.Profile{ProfileID: "201"}
+	stampCreate(db.Set(contextKey, ctx).NewScope(&profile))
+
+	if profile.CreatedBy != "user-1" || profile.UpdatedBy != "user-1" {
+		t.Errorf("created profile who columns are %q, %q", profile.CreatedBy, profile.UpdatedBy)
+	}
+
+	scope := db.Set(contextKey, auth.ServiceAccount(context.Background(), "image-sweeper")).NewScope(&entity.Profile{})
+	scope.InstanceSet("gorm:update_attrs", map[string]interface{}{"full_name": "Nimesh"})
+	stampUpdate(scope)
+
+	attrs, _ := scope.InstanceGet("gorm:update_attrs")
+	if by := attrs.(map[string]interface{})["updated_by"]; by != "service:image-sweeper" {
+		t.Errorf("update attributes are %v but expected updated_by of the service account", attrs)
+	}
+
+	scope = db.NewScope(&entity.Profile{})
+	scope.InstanceSet("gorm:update_attrs", map[string]interface{}{})
+	stampUpdate(scope)
+
+	attrs, _ = scope.InstanceGet("gorm:update_attrs")
+	if by := attrs.(map[string]interface{})["updated_by"]; by != auth.UnknownActor {
+		t.Errorf("update without context stamped %v", by)
+	}
+}
+
+func TestWhoCallbacksBelongToRepo(t *testing.T) {
+	pr := recordingRepo(t)
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "user-1"})
+
+	if _, err := pr.Create(ctx, entity.Profile{ProfileID: "201", TenantID: "acme"}); err != nil {
+		t.Fatalf("create error %s", err)
+	}
+	if insert := recorded.queries()[0]; !hasArg(insert, "user-1") {
+		t.Errorf("insert of the repo %v is not stamped with the actor", insert.args)
+	}
+
+	// a handle opened elsewhere runs with gorm.DefaultCallback, untouched by the repo
+	db, err := gorm.Open("postgres", pr.DB.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set(contextKey, ctx).Create(&entity.Profile{ProfileID: "202", TenantID: "acme"})
+
+	if insert := recorded.queries()[0]; hasArg(insert, "user-1") {
+		t.Errorf("insert of another handle %v is stamped by callbacks of the repo", insert.args)
+	}
+}
+
+func hasArg(s statement, value interface{}) bool {
+	for _, arg := range s.args {
+		if arg.Value == value {
+			return true
+		}
+	}
+	return false
+}
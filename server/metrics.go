@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"n_users/metrics"
+	"n_users/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "n_users_http_requests_total",
+		Help: "Number of HTTP requests by route pattern, method, status and tenant.",
+	}, []string{"route", "method", "status", "tenant"})
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "n_users_http_request_errors_total",
+		Help: "Number of HTTP requests answered with a 5xx status by route pattern, method and tenant.",
+	}, []string{"route", "method", "tenant"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "n_users_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route pattern, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// unmatchedRoute labels requests not matching any route, so that scanning random paths can not add series
+const unmatchedRoute = "unmatched"
+
+// noTenant labels requests rejected before their tenant was resolved and routes without tenant, like /_ready
+const noTenant = "none"
+
+// instrument records rate, errors and duration of requests by chi route pattern rather than path,
+// so that ids in the path do not create a series each
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		ctx, resolvedTenant := tenant.Track(r.Context())
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && len(rctx.RoutePattern()) > 0 {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		tenantLabel := noTenant
+		if id := resolvedTenant(); len(id) > 0 {
+			tenantLabel = metrics.Tenant(id)
+		}
+
+		code := strconv.Itoa(status)
+		requestsTotal.WithLabelValues(route, r.Method, code, tenantLabel).Inc()
+		if status >= http.StatusInternalServerError {
+			requestErrors.WithLabelValues(route, r.Method, tenantLabel).Inc()
+		}
+		requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsHandler serves /metrics of the default Prometheus registry, Go runtime and process metrics included
+func metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// ServeMetrics serves /metrics at address in background, apart from the public listener so that it can be
+// kept reachable only from inside the network. The returned function stops serving.
+func ServeMetrics(address string) (func() error, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: metricsHandler()}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("metrics server failed", zap.Error(err))
+		}
+	}()
+
+	zap.L().Info("started serving metrics", zap.String("address", ln.Addr().String()))
+	return srv.Close, nil
+}
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"n_users/config"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
@@ -11,36 +17,140 @@ import (
 
 // Server represents server interface
 type Server interface {
-	StartServer(address string)
+	// StartServer serves requests at given address until ctx is done, then shuts down gracefully.
+	// It returns error when the address can not be served or shutdown did not complete cleanly.
+	StartServer(ctx context.Context, address string) error
 	Register(path string, handle func(http.ResponseWriter, *http.Request), method string)
 	Mount(path string, handler http.Handler)
+	// OnDrain registers fn called as soon as shutdown starts, e.g. to fail readiness
+	OnDrain(fn func())
+	// OnClose registers fn releasing a resource once requests are drained. Resources are
+	// closed in reverse order of registration, like deferred calls.
+	OnClose(name string, fn func() error)
+}
+
+type closer struct {
+	Name  string
+	Close func() error
 }
 
 type server struct {
-	Router *chi.Mux
+	Router  *chi.Mux
+	Config  config.ServerConfig
+	mu      sync.Mutex
+	drains  []func()
+	closers []closer
 }
 
 // New creates new server object
-func New() Server {
+func New(cfg config.ServerConfig) Server {
 	router := chi.NewRouter()
 
-	router.Use(middleware.Timeout(3 * time.Second))
+	// outermost, so that timeouts and recovered panics are recorded with their status
+	router.Use(instrument)
+	router.Use(traced)
+	router.Use(timeout(cfg.RequestTimeout))
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.RequestID)
-	router.Use(middleware.Throttle(1000))
+	router.Use(middleware.Throttle(cfg.MaxConcurrentRequests))
 	router.Use(middleware.NoCache)
 	router.Use(middleware.SetHeader("Content-Type", "application/json"))
 
-	return &server{Router: router}
+	return &server{Router: router, Config: cfg}
+}
+
+// timeout bounds every request with a deadline. Unlike middleware.Timeout it writes no response
+// of its own, handlers answer 504 request_timeout once the deadline aborts a query or upload.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
 // StartServer starts HTTP server at given address
-func (s *server) StartServer(address string) {
+func (s *server) StartServer(ctx context.Context, address string) error {
+	// listen before serving so that a busy port fails startup instead of a background goroutine
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		s.close()
+		return err
+	}
+
+	srv := &http.Server{Handler: s.Router}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
 	zap.L().Info("started running server",
-		zap.String("address", address))
-	_ = http.ListenAndServe(address, s.Router)
+		zap.String("address", ln.Addr().String()))
+
+	select {
+	case err := <-served:
+		s.close()
+		return err
+	case <-ctx.Done():
+	}
+
+	return s.shutdown(srv)
+}
+
+// shutdown fails readiness, waits for load balancers to notice, drains in-flight requests
+// up to ShutdownTimeout and finally closes registered resources
+func (s *server) shutdown(srv *http.Server) error {
+	zap.L().Info("shutting down server",
+		zap.Duration("drain_delay", s.Config.DrainDelay),
+		zap.Duration("shutdown_timeout", s.Config.ShutdownTimeout))
+
+	s.mu.Lock()
+	drains := s.drains
+	s.mu.Unlock()
+
+	for _, fn := range drains {
+		fn()
+	}
+
+	time.Sleep(s.Config.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		zap.L().Error("in-flight requests were not drained", zap.Error(err))
+		srv.Close()
+	}
+
+	if closeErr := s.close(); err == nil {
+		err = closeErr
+	}
+
+	zap.L().Info("server stopped")
+	return err
+}
+
+// close releases registered resources in reverse order and returns the first failure
+func (s *server) close() error {
+	s.mu.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+
+	var first error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			zap.L().Error("error closing resource", zap.String("name", closers[i].Name), zap.Error(err))
+			if first == nil {
+				first = errors.New("error closing " + closers[i].Name + ": " + err.Error())
+			}
+		}
+	}
+
+	return first
 }
 
 // Register registers a path with the server
@@ -52,3 +162,15 @@ func (s *server) Register(path string, handle func(http.ResponseWriter, *http.Re
 func (s *server) Mount(path string, handler http.Handler) {
 	s.Router.Mount(path, handler)
 }
+
+func (s *server) OnDrain(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drains = append(s.drains, fn)
+}
+
+func (s *server) OnClose(name string, fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closers = append(s.closers, closer{Name: name, Close: fn})
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"n_users/config"
+	"n_users/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func freeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func testConfig() config.ServerConfig {
+	cfg := config.Default().Server
+	cfg.DrainDelay = 50 * time.Millisecond
+	cfg.ShutdownTimeout = 2 * time.Second
+	return cfg
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := New(testConfig())
+
+	started := make(chan struct{})
+	s.Register("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}, http.MethodGet)
+
+	var events []string
+	s.OnDrain(func() { events = append(events, "drain") })
+	s.OnClose("db", func() error { events = append(events, "close db"); return nil })
+	s.OnClose("sweeper", func() error { events = append(events, "close sweeper"); return nil })
+
+	address := freeAddress(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.StartServer(ctx, address) }()
+
+	body := make(chan string, 1)
+	go func() {
+		for i := 0; i < 50; i++ {
+			res, err := http.Get("http://" + address + "/slow")
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			b, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			body <- string(b)
+			return
+		}
+		body <- ""
+	}()
+
+	<-started
+	cancel()
+
+	if b := <-body; b != "done" {
+		t.Errorf("in-flight request responded %q but expected done", b)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Errorf("graceful shutdown error %s", err)
+	}
+
+	if strings.Join(events, ", ") != "drain, close sweeper, close db" {
+		t.Errorf("shutdown events are %v", events)
+	}
+}
+
+func TestStartServerReportsBusyPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	closed := false
+	s := New(testConfig())
+	s.OnClose("db", func() error { closed = true; return nil })
+
+	if err := s.StartServer(context.Background(), ln.Addr().String()); err == nil {
+		t.Errorf("server started on a busy port")
+	}
+
+	if !closed {
+		t.Errorf("resources were not closed after failed start")
+	}
+}
+
+func TestShutdownReportsCloseError(t *testing.T) {
+	s := New(testConfig())
+	s.OnClose("db", func() error { return errors.New("boom") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.StartServer(ctx, freeAddress(t)); err == nil || !strings.Contains(err.Error(), "db") {
+		t.Errorf("shutdown error is %v but expected close failure of db", err)
+	}
+}
+
+func TestRequestMetricsUseRoutePattern(t *testing.T) {
+	s := New(testConfig()).(*server)
+
+	profiles := chi.NewRouter()
+	profiles.Get("/{ProfileID}", func(w http.ResponseWriter, r *http.Request) {
+		// the tenant is labelled once resolved further down the chain
+		tenant.WithID(r.Context(), "acme")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	s.Mount("/metrics-test", profiles)
+
+	for _, id := range []string{"1", "2"} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics-test/"+id, nil)
+		s.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := testutil.ToFloat64(requestsTotal.WithLabelValues("/metrics-test/{ProfileID}", "GET", "503", "acme")); n != 2 {
+		t.Errorf("requests of route pattern counted %v, expected 2", n)
+	}
+	if n := testutil.ToFloat64(requestErrors.WithLabelValues("/metrics-test/{ProfileID}", "GET", "acme")); n != 2 {
+		t.Errorf("errors of route pattern counted %v, expected 2", n)
+	}
+
+	s.Router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no-such-route", nil))
+	if n := testutil.ToFloat64(requestsTotal.WithLabelValues(unmatchedRoute, "GET", "404", noTenant)); n != 1 {
+		t.Errorf("unmatched request without tenant counted %v, expected 1", n)
+	}
+
+	// metrics are served on the internal listener only
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("public router served /metrics with %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	metricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, series := range []string{
+		`n_users_http_requests_total{method="GET",route="/metrics-test/{ProfileID}",status="503",tenant="acme"} 2`,
+		`n_users_http_request_duration_seconds_count{method="GET",route="/metrics-test/{ProfileID}",status="503"} 2`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(w.Body.String(), series) {
+			t.Errorf("metrics endpoint didn't expose %s:\n%s", series, w.Body.String())
+		}
+	}
+}
+
+// headers counts the status lines written to the response
+type headers struct {
+	*httptest.ResponseRecorder
+	written int
+}
+
+func (h *headers) WriteHeader(code int) {
+	h.written++
+	h.ResponseRecorder.WriteHeader(code)
+}
+
+func TestTimedOutRequestIsAnsweredOnce(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte(`{"code":"request_timeout"}`))
+	})
+
+	w := &headers{ResponseRecorder: httptest.NewRecorder()}
+	timeout(10*time.Millisecond)(slow).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.written != 1 || w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), "request_timeout") {
+		t.Errorf("timed out request wrote %d headers, %d %s but expected one 504 of the handler", w.written, w.Code, w.Body)
+	}
+}
+
+func TestRequestContinuesCallerTrace(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	s := New(testConfig()).(*server)
+	profiles := chi.NewRouter()
+	profiles.Get("/{ProfileID}", func(w http.ResponseWriter, r *http.Request) {})
+	s.Mount("/traced", profiles)
+
+	req := httptest.NewRequest(http.MethodGet, "/traced/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, expected 1", len(spans))
+	}
+
+	span := spans[0]
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span trace id is %s, expected trace id of traceparent", span.SpanContext().TraceID())
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span parent is %s, expected span id of traceparent", span.Parent().SpanID())
+	}
+	if span.Name() != "GET /traced/{ProfileID}" {
+		t.Errorf("span name is %s", span.Name())
+	}
+}
@@ -0,0 +1,170 @@
+// Package tenant resolves the tenant of a request and checks it against the tenant registry
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"n_users/auth"
+	"n_users/config"
+	"n_users/entity"
+)
+
+// maxCached bounds the registry cache, it is cleared when full so that made up tenant ids can not grow it
+const maxCached = 10000
+
+// errors returned by Resolve
+var (
+	ErrRequired  = entity.NewDomainError(entity.KindValidation, "tenant_required", "tenant of the request is missing")
+	ErrMismatch  = entity.NewDomainError(entity.KindForbidden, "tenant_mismatch", "tenant does not match the token tenant")
+	ErrUnknown   = entity.NewDomainError(entity.KindForbidden, "unknown_tenant", "tenant is not registered")
+	ErrSuspended = entity.NewDomainError(entity.KindForbidden, "tenant_suspended", "tenant is suspended")
+)
+
+type idKey struct{}
+
+// slot receives the tenant resolved further down the middleware chain
+type slot struct {
+	id string
+}
+
+type slotKey struct{}
+
+// WithID returns ctx carrying the tenant id, it is also recorded for Track
+func WithID(ctx context.Context, id string) context.Context {
+	if s, ok := ctx.Value(slotKey{}).(*slot); ok {
+		s.id = id
+	}
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the tenant id of ctx, false when no tenant was resolved
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(idKey{}).(string)
+	return id, ok
+}
+
+// Track returns ctx recording the tenant resolved while serving the request and a function
+// returning it, so that middleware running before resolution, like metrics, can label requests.
+func Track(ctx context.Context) (context.Context, func() string) {
+	s := &slot{}
+	return context.WithValue(ctx, slotKey{}, s), func() string { return s.id }
+}
+
+// Registry looks up tenants, entries are cached for TTL
+type Registry struct {
+	Lookup func(ctx context.Context, tenantID string) (entity.Tenant, error)
+	TTL    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	tenant  entity.Tenant
+	found   bool
+	expires time.Time
+}
+
+// NewRegistry creates new object of Registry reading tenants with lookup
+func NewRegistry(lookup func(ctx context.Context, tenantID string) (entity.Tenant, error), ttl time.Duration) *Registry {
+	return &Registry{Lookup: lookup, TTL: ttl, cache: map[string]cached{}}
+}
+
+// Get returns the tenant, false when it is not registered. Lookup failures are not cached.
+func (reg *Registry) Get(ctx context.Context, tenantID string) (entity.Tenant, bool, error) {
+	reg.mu.Lock()
+	c, ok := reg.cache[tenantID]
+	reg.mu.Unlock()
+
+	if ok && time.Now().Before(c.expires) {
+		return c.tenant, c.found, nil
+	}
+
+	t, err := reg.Lookup(ctx, tenantID)
+	found := err == nil
+	if err != nil && entity.AsDomainError(err).Kind != entity.KindNotFound {
+		return entity.Tenant{}, false, err
+	}
+
+	reg.mu.Lock()
+	if len(reg.cache) >= maxCached {
+		reg.cache = map[string]cached{}
+	}
+	reg.cache[tenantID] = cached{tenant: t, found: found, expires: time.Now().Add(reg.TTL)}
+	reg.mu.Unlock()
+
+	return t, found, nil
+}
+
+// Resolver finds the tenant of a request from the configured source and checks it is active
+type Resolver struct {
+	Config   config.TenantsConfig
+	Registry *Registry
+}
+
+// NewResolver creates new object of Resolver checking tenants with registry
+func NewResolver(cfg config.TenantsConfig, registry *Registry) *Resolver {
+	return &Resolver{Config: cfg, Registry: registry}
+}
+
+// Resolve returns the active tenant of r. Tenants named by subdomain or header must match the tenant
+// claim of the principal. Only admins, which act across tenants, may name one without holding a
+// tenant claim.
+func (res *Resolver) Resolve(r *http.Request) (string, error) {
+	p, _ := auth.FromContext(r.Context())
+
+	var id string
+	switch res.Config.Source {
+	case "claim":
+		id = p.Tenant
+	case "subdomain":
+		id = subdomain(r.Host, res.Config.BaseDomain)
+	case "header":
+		id = strings.TrimSpace(r.Header.Get(res.Config.Header))
+	}
+
+	if len(id) == 0 {
+		return "", ErrRequired
+	}
+
+	if len(p.Tenant) == 0 && !p.HasScope(auth.ScopeAdmin) {
+		return "", ErrMismatch
+	}
+
+	if len(p.Tenant) > 0 && p.Tenant != id {
+		return "", ErrMismatch
+	}
+
+	t, found, err := res.Registry.Get(r.Context(), id)
+	switch {
+	case err != nil:
+		return "", err
+	case !found:
+		return "", ErrUnknown
+	case t.Status != entity.TenantActive:
+		return "", ErrSuspended
+	}
+
+	return id, nil
+}
+
+// subdomain returns the single label host has in front of baseDomain, e.g. acme of acme.users.example.com
+func subdomain(host, baseDomain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+
+	label := strings.TrimSuffix(host, suffix)
+	if label == host || len(label) == 0 || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
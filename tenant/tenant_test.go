@@ -0,0 +1,117 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"n_users/auth"
+	"n_users/config"
+	"n_users/entity"
+)
+
+func registry(lookups *int) *Registry {
+	tenants := map[string]entity.Tenant{
+		"acme":   {TenantID: "acme", Status: entity.TenantActive},
+		"globex": {TenantID: "globex", Status: entity.TenantSuspended},
+	}
+
+	return NewRegistry(func(ctx context.Context, id string) (entity.Tenant, error) {
+		*lookups++
+		if id == "flaky" {
+			return entity.Tenant{}, errors.New("connection refused")
+		}
+		if t, ok := tenants[id]; ok {
+			return t, nil
+		}
+		return entity.Tenant{}, entity.NewDomainError(entity.KindNotFound, "tenant_not_found", "tenant not found")
+	}, time.Minute)
+}
+
+func TestResolve(t *testing.T) {
+	lookups := 0
+	reg := registry(&lookups)
+
+	claim := NewResolver(config.TenantsConfig{Source: "claim"}, reg)
+	header := NewResolver(config.TenantsConfig{Source: "header", Header: "ntenant"}, reg)
+	sub := NewResolver(config.TenantsConfig{Source: "subdomain", BaseDomain: "users.example.com"}, reg)
+
+	user := func(tenant string) auth.Principal { return auth.Principal{Subject: "user-1", Tenant: tenant} }
+	admin := auth.Principal{Subject: "admin-1", Scopes: []string{auth.ScopeAdmin}}
+	// a token subject never makes a service account, those exist in process only
+	spoofed := auth.Principal{Subject: "service:image-sweeper"}
+
+	cases := []struct {
+		name      string
+		resolver  *Resolver
+		host      string
+		header    string
+		principal auth.Principal
+		tenant    string
+		err       error
+	}{
+		{"claim", claim, "", "", user("acme"), "acme", nil},
+		{"claim ignores header", claim, "", "globex", user("acme"), "acme", nil},
+		{"missing claim", claim, "", "acme", user(""), "", ErrRequired},
+		{"header matching claim", header, "", "acme", user("acme"), "acme", nil},
+		{"header of other tenant", header, "", "initech", user("acme"), "", ErrMismatch},
+		{"header without claim", header, "", "acme", user(""), "", ErrMismatch},
+		{"header of admin without claim", header, "", "acme", admin, "acme", nil},
+		{"header of service subject", header, "", "acme", spoofed, "", ErrMismatch},
+		{"missing header", header, "", "", user("acme"), "", ErrRequired},
+		{"subdomain", sub, "ACME.users.example.com:8085", "", user("acme"), "acme", nil},
+		{"subdomain without claim", sub, "acme.users.example.com", "", user(""), "", ErrMismatch},
+		{"nested subdomain", sub, "a.acme.users.example.com", "", user("acme"), "", ErrRequired},
+		{"other domain", sub, "acme.example.org", "", user("acme"), "", ErrRequired},
+		{"unknown", header, "", "initech", admin, "", ErrUnknown},
+		{"suspended", claim, "", "", user("globex"), "", ErrSuspended},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/profiles/1", nil)
+		if len(c.host) > 0 {
+			req.Host = c.host
+		}
+		req.Header.Set("ntenant", c.header)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), c.principal))
+
+		id, err := c.resolver.Resolve(req)
+		if id != c.tenant || err != c.err {
+			t.Errorf("%s: resolved %q, %v but expected %q, %v", c.name, id, err, c.tenant, c.err)
+		}
+	}
+
+	// acme, globex and initech were each looked up once
+	if lookups != 3 {
+		t.Errorf("registry looked up %d times but expected cached results", lookups)
+	}
+}
+
+func TestRegistryDoesNotCacheFailures(t *testing.T) {
+	lookups := 0
+	reg := registry(&lookups)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := reg.Get(context.Background(), "flaky"); err == nil {
+			t.Errorf("lookup failure was not returned")
+		}
+	}
+
+	if lookups != 2 {
+		t.Errorf("failed lookup was cached")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	ctx, resolved := Track(context.Background())
+	if id := resolved(); id != "" {
+		t.Errorf("tenant %q resolved before WithID", id)
+	}
+
+	if id, ok := FromContext(WithID(ctx, "acme")); !ok || id != "acme" || resolved() != "acme" {
+		t.Errorf("tenant %q, %v was not recorded", id, ok)
+	}
+}
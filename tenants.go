@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"n_users/config"
+	"n_users/entity"
+)
+
+const tenantsUsage = "usage: n_users tenants add <id> [name] | suspend <id> | activate <id> | list"
+
+// runTenants runs tenants subcommand against the tenant registry of the configured database and returns exit code
+func runTenants(cfg config.DatabaseConfig, args []string) int {
+	if len(args) == 0 || (args[0] != "list" && len(args) < 2) {
+		fmt.Fprintln(os.Stderr, tenantsUsage)
+		return 2
+	}
+
+	db, err := sql.Open("postgres", string(cfg.URL))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error opening database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	var res sql.Result
+	switch args[0] {
+	case "add":
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		res, err = db.Exec("INSERT INTO tenants (tenant_id, name, status) VALUES ($1, $2, $3) ON CONFLICT (tenant_id) DO NOTHING",
+			args[1], name, entity.TenantActive)
+	case "suspend":
+		res, err = db.Exec("UPDATE tenants SET status = $2, updated_at = now() WHERE tenant_id = $1", args[1], entity.TenantSuspended)
+	case "activate":
+		res, err = db.Exec("UPDATE tenants SET status = $2, updated_at = now() WHERE tenant_id = $1", args[1], entity.TenantActive)
+	case "list":
+		return listTenants(db)
+	default:
+		fmt.Fprintln(os.Stderr, tenantsUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		fmt.Fprintf(os.Stderr, "tenant %s was not changed, it is already registered or does not exist\n", args[1])
+		return 1
+	}
+
+	fmt.Printf("%s tenant %s\n", args[0], args[1])
+	return 0
+}
+
+func listTenants(db *sql.DB) int {
+	rows, err := db.Query("SELECT tenant_id, name, status FROM tenants ORDER BY tenant_id")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t entity.Tenant
+		if err := rows.Scan(&t.TenantID, &t.Name, &t.Status); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s\t%s\t%s\n", t.TenantID, t.Status, t.Name)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewOTLPExporter creates an exporter sending spans to the OTLP/HTTP traces endpoint, a url like
+// http://localhost:4318/v1/traces. Requests are gzip compressed and retried on transient failures.
+func NewOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(u.Path),
+		otlptracehttp.WithCompression(otlptracehttp.GzipCompression),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	// the client connects lazily, so creating it does not wait for the collector
+	return otlptracehttp.New(context.Background(), opts...)
+}
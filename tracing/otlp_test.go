@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPExporterSendsProtobuf(t *testing.T) {
+	var received coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("collector received %s with content type %s and encoding %s", r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding"))
+		}
+
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(body)
+		if err := proto.Unmarshal(b, &received); err != nil {
+			t.Errorf("request is not an ExportTraceServiceRequest: %s", err)
+		}
+	}))
+	defer collector.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, parent := tp.Tracer("n_users").Start(context.Background(), "parent")
+	_, child := tp.Tracer("n_users").Start(ctx, "child")
+	child.SetAttributes(attribute.Int64("db.rows_affected", 3))
+	End(child, errors.New("boom"))
+	parent.End()
+
+	exporter, err := NewOTLPExporter(collector.URL + "/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+
+	if err := exporter.ExportSpans(context.Background(), recorder.Ended()); err != nil {
+		t.Fatalf("export error %s", err)
+	}
+
+	spans := received.GetResourceSpans()[0].GetScopeSpans()[0].GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("collector received %d spans, expected 2", len(spans))
+	}
+
+	c := spans[0]
+	if c.GetName() != "child" || hex.EncodeToString(c.GetParentSpanId()) != parent.SpanContext().SpanID().String() {
+		t.Errorf("child span is %v", c)
+	}
+	if hex.EncodeToString(c.GetTraceId()) != parent.SpanContext().TraceID().String() {
+		t.Errorf("child trace id is %x, expected %s", c.GetTraceId(), parent.SpanContext().TraceID())
+	}
+	if status := c.GetStatus(); status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || status.GetMessage() != "boom" {
+		t.Errorf("child status is %v", status)
+	}
+
+	if attr := c.GetAttributes()[0]; attr.GetKey() != "db.rows_affected" || attr.GetValue().GetIntValue() != 3 {
+		t.Errorf("child attribute is %v", attr)
+	}
+}
+
+func TestOTLPExporterReportsCollectorFailure(t *testing.T) {
+	// a rejected request is not retried, unlike unavailable collectors
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	_, span := tp.Tracer("n_users").Start(context.Background(), "span")
+	span.End()
+
+	exporter, err := NewOTLPExporter(collector.URL + "/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+
+	if err := exporter.ExportSpans(context.Background(), recorder.Ended()); err == nil {
+		t.Errorf("export succeeded although collector failed")
+	}
+}
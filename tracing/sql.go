@@ -0,0 +1,16 @@
+package tracing
+
+import "regexp"
+
+var (
+	sqlString = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// numbers are replaced unless they are part of an identifier or a $1 placeholder
+	sqlNumber = regexp.MustCompile(`(^|[^\w$.])-?\d+(?:\.\d+)?`)
+)
+
+// SanitizeSQL replaces literals in query with ?, so that span attributes never carry profile data.
+// Values bound to placeholders are not part of query and are never recorded.
+func SanitizeSQL(query string) string {
+	query = sqlString.ReplaceAllString(query, "?")
+	return sqlNumber.ReplaceAllString(query, "${1}?")
+}
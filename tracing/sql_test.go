@@ -0,0 +1,29 @@
+package tracing
+
+import "testing"
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    `SELECT * FROM "profiles" WHERE (tenant_id = $1) LIMIT 10 OFFSET 20`,
+			expected: `SELECT * FROM "profiles" WHERE (tenant_id = $1) LIMIT ? OFFSET ?`,
+		},
+		{
+			query:    `UPDATE "profiles" SET "email_id" = 'jane@example.com', "version" = version + 1 WHERE name = 'O''Brien'`,
+			expected: `UPDATE "profiles" SET "email_id" = ?, "version" = version + ? WHERE name = ?`,
+		},
+		{
+			query:    `SELECT ts_rank(document, query) FROM profiles_v2 WHERE latitude > -12.5`,
+			expected: `SELECT ts_rank(document, query) FROM profiles_v2 WHERE latitude > ?`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeSQL(tt.query); got != tt.expected {
+			t.Errorf("SanitizeSQL(%q) = %q, expected %q", tt.query, got, tt.expected)
+		}
+	}
+}
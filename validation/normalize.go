@@ -0,0 +1,37 @@
+package validation
+
+import "strings"
+
+// NormalizeEmail returns canonical form of an email address used for storage and uniqueness.
+// Addresses are compared case insensitively, so the whole address is lower-cased.
+func NormalizeEmail(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// a trailing dot marks a fully qualified domain, it names the same domain
+	return strings.TrimSuffix(s, ".")
+}
+
+// NormalizeMobile returns E.164 form of a phone number written with common separators,
+// e.g. "+91 88888-00000" or "0091 (888) 8800000". Input with other characters is returned
+// unchanged so that validation reports it.
+func NormalizeMobile(s string) string {
+	s = strings.TrimSpace(s)
+
+	// international call prefix used in most countries
+	if strings.HasPrefix(s, "00") {
+		s = "+" + s[2:]
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '+' && i == 0, r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return s
+		}
+	}
+
+	return b.String()
+}
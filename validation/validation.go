@@ -0,0 +1,159 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"n_users/entity"
+)
+
+// maxAgeYears is the oldest plausible age of a profile owner
+const maxAgeYears = 130
+
+// maxEmailLength is the longest email address accepted by SMTP
+const maxEmailLength = 254
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// rule checks a single non empty field value, it returns message of the failure or empty string
+type rule func(v reflect.Value, param string) string
+
+// rules maps names used in validate tags to their checks. The tag is a comma separated
+// list evaluated in order, e.g. `validate:"required,email"` or `validate:"omitempty,oneof=a b"`.
+// "required" rejects zero values, "omitempty" skips remaining rules for zero values.
+var rules = map[string]rule{
+	"email":     email,
+	"e164":      e164,
+	"birthdate": birthDate,
+	"oneof":     oneOf,
+}
+
+// Struct validates fields of v, a struct or pointer to struct, against their validate tags.
+// It returns a validation error caused by entity.FieldErrors listing every invalid field,
+// nil when v is valid.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic("validation: Struct called with " + value.Kind().String())
+	}
+
+	var errs entity.FieldErrors
+	t := value.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		if e, failed := check(value.Field(i), tag); failed {
+			e.Field = fieldName(field)
+			errs = append(errs, e)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return entity.WrapError(entity.KindValidation, "validation_failed", "invalid fields", errs)
+}
+
+// check evaluates rules of tag against v and returns the first failure
+func check(v reflect.Value, tag string) (entity.FieldError, bool) {
+	for _, name := range strings.Split(tag, ",") {
+		name, param := splitRule(name)
+
+		switch name {
+		case "required":
+			if v.IsZero() {
+				return entity.FieldError{Code: name, Message: "is required"}, true
+			}
+		case "omitempty":
+			if v.IsZero() {
+				return entity.FieldError{}, false
+			}
+		default:
+			r, ok := rules[name]
+			if !ok {
+				panic("validation: unknown rule " + name)
+			}
+
+			if msg := r(v, param); len(msg) > 0 {
+				return entity.FieldError{Code: name, Message: msg}, true
+			}
+		}
+	}
+
+	return entity.FieldError{}, false
+}
+
+func splitRule(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "="); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// fieldName returns the name clients use for the field, the json name when it has one
+func fieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if len(name) == 0 || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+func email(v reflect.Value, _ string) string {
+	s := v.String()
+
+	// display names like "Nimesh <n@x.com>" are not addresses
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || len(s) > maxEmailLength || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+		return "must be a valid email address"
+	}
+
+	return ""
+}
+
+func e164(v reflect.Value, _ string) string {
+	if !e164Pattern.MatchString(v.String()) {
+		return "must be an E.164 phone number like +14155550123"
+	}
+	return ""
+}
+
+func birthDate(v reflect.Value, _ string) string {
+	d, ok := v.Interface().(time.Time)
+	if !ok {
+		panic("validation: birthdate rule on " + v.Type().String())
+	}
+
+	now := time.Now()
+	if d.After(now) {
+		return "must not be in the future"
+	}
+
+	if d.Before(now.AddDate(-maxAgeYears, 0, 0)) {
+		return fmt.Sprintf("must be within the last %d years", maxAgeYears)
+	}
+
+	return ""
+}
+
+func oneOf(v reflect.Value, param string) string {
+	allowed := strings.Fields(param)
+	for _, a := range allowed {
+		if v.String() == a {
+			return ""
+		}
+	}
+
+	return "must be one of " + strings.Join(allowed, ", ")
+}
@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"n_users/entity"
+)
+
+type person struct {
+	Name      string    `json:"name" validate:"required"`
+	Email     string    `json:"email" validate:"omitempty,email"`
+	Mobile    string    `validate:"omitempty,e164"`
+	Gender    string    `json:"gender,omitempty" validate:"omitempty,oneof=male female"`
+	BirthDate time.Time `json:"birth_date" validate:"omitempty,birthdate"`
+	Ignored   string
+}
+
+func TestStruct(t *testing.T) {
+	valid := []person{
+		{Name: "a"},
+		{Name: "a", Email: "a.b@example.com", Mobile: "+14155550123", Gender: "female", BirthDate: time.Now().AddDate(-30, 0, 0)},
+	}
+
+	for _, p := range valid {
+		if err := Struct(p); err != nil {
+			t.Errorf("%+v failed validation %s", p, err)
+		}
+	}
+
+	cases := map[string]person{
+		"name":       {},
+		"email":      {Name: "a", Email: "Nimesh <a@example.com>"},
+		"Mobile":     {Name: "a", Mobile: "+0123456789"},
+		"gender":     {Name: "a", Gender: "Male"},
+		"birth_date": {Name: "a", BirthDate: time.Now().AddDate(-200, 0, 0)},
+	}
+
+	for field, p := range cases {
+		err := Struct(&p)
+
+		var fields entity.FieldErrors
+		if !errors.As(err, &fields) || len(fields) != 1 || fields[0].Field != field {
+			t.Errorf("%+v failed validation with %v but expected error on %s", p, err, field)
+		}
+
+		if e := entity.AsDomainError(err); e.Kind != entity.KindValidation {
+			t.Errorf("%+v validation error kind is %s", p, e.Kind)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	for _, s := range []string{"nimesh@gmail.com", "a+b@sub.example.org"} {
+		if err := Struct(person{Name: "a", Email: s}); err != nil {
+			t.Errorf("email %s failed validation %s", s, err)
+		}
+	}
+
+	for _, s := range []string{"nimesh", "nimesh@", "@gmail.com", "nimesh@localhost", "a b@gmail.com"} {
+		if err := Struct(person{Name: "a", Email: s}); err == nil {
+			t.Errorf("email %s passed validation", s)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	emails := map[string]string{
+		" Nimesh.Mittal@Gmail.COM ": "nimesh.mittal@gmail.com",
+		"a@example.org.":            "a@example.org",
+	}
+
+	for in, expected := range emails {
+		if out := NormalizeEmail(in); out != expected {
+			t.Errorf("email %q normalized to %q but expected %q", in, out, expected)
+		}
+	}
+
+	mobiles := map[string]string{
+		"+91 88888-00000":    "+918888800000",
+		"0091 (888) 8800000": "+918888800000",
+		"+1.415.555.0123":    "+14155550123",
+		"+91 8888x00000":     "+91 8888x00000",
+	}
+
+	for in, expected := range mobiles {
+		if out := NormalizeMobile(in); out != expected {
+			t.Errorf("mobile %q normalized to %q but expected %q", in, out, expected)
+		}
+	}
+}